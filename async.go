@@ -0,0 +1,67 @@
+package gohessian
+
+import (
+	"context"
+	"sync"
+)
+
+// Call is an asynchronous hessian call
+type Call struct {
+	Method string
+	Params []interface{}
+	Reply  interface{}
+	Error  error
+	Done   chan *Call // receives the call itself when it is complete
+}
+
+// BatchRequest is one call of a batch
+type BatchRequest struct {
+	Method string
+	Params []interface{}
+}
+
+// Go invoke method asynchronously and return the call at once, the Done
+// channel of the call receives it when it is complete. BindResult does not
+// see replies of asynchronous calls, use Bind on Call.Reply instead.
+func (c *Client) Go(ctx context.Context, method string, params ...interface{}) *Call {
+	call := &Call{
+		Method: method,
+		Params: params,
+		Done:   make(chan *Call, 1),
+	}
+	go func() {
+		call.Reply, call.Error = c.call(ctx, method, params)
+		call.Done <- call
+	}()
+	return call
+}
+
+// Batch invoke reqs concurrently with at most limit calls in flight, limit
+// less than 1 means no limit. It return when all calls are complete, the
+// calls are in the order of reqs.
+func (c *Client) Batch(ctx context.Context, limit int, reqs ...BatchRequest) []*Call {
+	if limit < 1 {
+		limit = len(reqs)
+	}
+	calls := make([]*Call, len(reqs))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		call := &Call{
+			Method: req.Method,
+			Params: req.Params,
+			Done:   make(chan *Call, 1),
+		}
+		calls[i] = call
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			call.Reply, call.Error = c.call(ctx, call.Method, call.Params)
+			<-sem
+			call.Done <- call
+		}()
+	}
+	wg.Wait()
+	return calls
+}
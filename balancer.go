@@ -0,0 +1,144 @@
+package gohessian
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoEndpoint is returned when every endpoint of a client is ejected or
+// has already failed for the call
+var ErrNoEndpoint = errors.New("no available endpoint")
+
+// Endpoint is one location of a hessian service served by several hosts
+type Endpoint struct {
+	Host string
+	URL  string
+
+	outstanding int64 // calls in flight, accessed atomically
+
+	mu           sync.Mutex
+	failures     int       // consecutive transport failures
+	ejectedUntil time.Time // zero when the endpoint is healthy
+}
+
+// String format endpoint request location
+func (e *Endpoint) String() string {
+	return e.Host + e.URL
+}
+
+// Outstanding return the number of calls in flight on the endpoint
+func (e *Endpoint) Outstanding() int64 {
+	return atomic.LoadInt64(&e.outstanding)
+}
+
+// Ejected report whether the endpoint is ejected at now
+func (e *Endpoint) Ejected(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return now.Before(e.ejectedUntil)
+}
+
+// report record the result of a call on the endpoint
+func (e *Endpoint) report(err error, p HealthPolicy, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if Classify(err) != ClassTransport {
+		e.failures = 0
+		e.ejectedUntil = time.Time{}
+		return
+	}
+	e.failures++
+	if p.MaxFailures > 0 && e.failures >= p.MaxFailures {
+		e.ejectedUntil = now.Add(p.ProbeAfter)
+	}
+}
+
+// HealthPolicy describe the passive health tracking of endpoints
+type HealthPolicy struct {
+	// MaxFailures is the number of consecutive transport failures after
+	// which an endpoint is ejected, zero never ejects
+	MaxFailures int
+	// ProbeAfter is how long an endpoint stays ejected before a call is
+	// sent to it again
+	ProbeAfter time.Duration
+}
+
+// Balancer choose the endpoint of a call among candidates, which is never empty
+type Balancer interface {
+	Pick(candidates []*Endpoint) *Endpoint
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// RoundRobin return a balancer which cycles through the endpoints
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Pick(candidates []*Endpoint) *Endpoint {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+type random struct{}
+
+// Random return a balancer which picks endpoints at random
+func Random() Balancer {
+	return random{}
+}
+
+func (random) Pick(candidates []*Endpoint) *Endpoint {
+	return candidates[rand.Intn(len(candidates))]
+}
+
+type leastOutstanding struct{}
+
+// LeastOutstanding return a balancer which picks the endpoint with the
+// fewest calls in flight
+func LeastOutstanding() Balancer {
+	return leastOutstanding{}
+}
+
+func (leastOutstanding) Pick(candidates []*Endpoint) *Endpoint {
+	best := candidates[0]
+	for _, e := range candidates[1:] {
+		if e.Outstanding() < best.Outstanding() {
+			best = e
+		}
+	}
+	return best
+}
+
+// WithBalancer set the strategy choosing endpoints, defaults to RoundRobin
+func WithBalancer(b Balancer) Option {
+	return func(c *Client) {
+		c.balancer = b
+	}
+}
+
+// WithHealthPolicy set the passive health tracking of endpoints
+func WithHealthPolicy(p HealthPolicy) Option {
+	return func(c *Client) {
+		c.health = p
+	}
+}
+
+// pick choose an endpoint which is neither ejected nor tried, nil if none
+func (c *Client) pick(tried map[*Endpoint]bool) *Endpoint {
+	now := time.Now()
+	candidates := make([]*Endpoint, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		if !tried[e] && !e.Ejected(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return c.balancer.Pick(candidates)
+}
@@ -0,0 +1,164 @@
+package gohessian
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+)
+
+const (
+	javaBigDecimal = "java.math.BigDecimal"
+	javaBigInteger = "java.math.BigInteger"
+)
+
+// Decimal is a decimal number in the string form of java.math.BigDecimal,
+// like "12.30", which keeps monetary values exact. Replies decode
+// java.math.BigDecimal as Decimal.
+type Decimal string
+
+// decimalSyntax is the string form java.math.BigDecimal parses: a sign,
+// digits with an optional fraction and an optional exponent
+var decimalSyntax = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// Rat return the exact value of the decimal, false if it is malformed
+func (d Decimal) Rat() (*big.Rat, bool) {
+	if !decimalSyntax.MatchString(string(d)) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(string(d))
+}
+
+// MarshalHessian encode the decimal as java.math.BigDecimal
+func (d Decimal) MarshalHessian() ([]byte, error) {
+	if _, ok := d.Rat(); !ok {
+		return nil, fmt.Errorf("invalid decimal %q", string(d))
+	}
+	return encodeClassString(javaBigDecimal, "value", string(d))
+}
+
+// UnmarshalHessian bind a decoded java.math.BigDecimal, a string or a number
+func (d *Decimal) UnmarshalHessian(v interface{}) error {
+	s, err := bigString(v)
+	if err != nil {
+		return err
+	}
+	if s != "" {
+		if _, ok := Decimal(s).Rat(); !ok {
+			return fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+	*d = Decimal(s)
+	return nil
+}
+
+func init() {
+	RegisterType(javaBigDecimal, Decimal(""))
+	RegisterType(javaBigInteger, (*big.Int)(nil))
+}
+
+// encodeBigInt encode *big.Int as java.math.BigInteger
+func encodeBigInt(v *big.Int) ([]byte, error) {
+	return encodeClassString(javaBigInteger, "value", v.String())
+}
+
+// encodeBigFloat encode *big.Float as java.math.BigDecimal
+func encodeBigFloat(v *big.Float) ([]byte, error) {
+	if v.IsInf() {
+		return nil, fmt.Errorf("cannot encode %v as %s", v, javaBigDecimal)
+	}
+	return encodeClassString(javaBigDecimal, "value", v.Text('f', -1))
+}
+
+// bigString return the string form of a decoded big number, a map with
+// its string value, a string or a number
+func bigString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case Decimal:
+		return string(v), nil
+	case big.Int:
+		return v.String(), nil
+	case big.Float:
+		return v.Text('f', -1), nil
+	case int32, int64:
+		return fmt.Sprint(v), nil
+	case float64:
+		return big.NewFloat(v).Text('f', -1), nil
+	case TypedMap:
+		return bigString(v.Entries)
+	case map[interface{}]interface{}:
+		if s, ok := v["value"].(string); ok {
+			return s, nil
+		}
+		if i, ok := bigIntFromMag(v); ok {
+			return i.String(), nil
+		}
+	}
+	return "", fmt.Errorf("cannot convert %T to a big number", v)
+}
+
+// bigIntFromMag build a BigInteger serialized by its signum and magnitude
+// fields, the magnitude is big endian 32 bits words
+func bigIntFromMag(m map[interface{}]interface{}) (*big.Int, bool) {
+	signum, ok := m["signum"].(int32)
+	if !ok {
+		return nil, false
+	}
+	var words []interface{}
+	switch mag := m["mag"].(type) {
+	case []interface{}:
+		words = mag
+	case TypedList:
+		words = mag.Items
+	default:
+		return nil, false
+	}
+	i := new(big.Int)
+	for _, w := range words {
+		word, ok := w.(int32)
+		if !ok {
+			return nil, false
+		}
+		i.Lsh(i, 32).Or(i, big.NewInt(int64(uint32(word))))
+	}
+	if signum < 0 {
+		i.Neg(i)
+	}
+	return i, true
+}
+
+var (
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+)
+
+// extractBig bind a decoded big number to value of type big.Int or
+// big.Float, ok is false for other types
+func extractBig(data reflect.Value, value reflect.Value) (ok bool, err error) {
+	if value.Type() != bigIntType && value.Type() != bigFloatType {
+		return false, nil
+	}
+	var d interface{}
+	if data.IsValid() {
+		d = data.Interface()
+	}
+	s, err := bigString(d)
+	if err != nil || s == "" {
+		return true, err
+	}
+	switch x := value.Addr().Interface().(type) {
+	case *big.Int:
+		if _, ok = x.SetString(s, 10); !ok {
+			return true, fmt.Errorf("invalid integer %q", s)
+		}
+	case *big.Float:
+		if _, ok = x.SetString(s); !ok {
+			return true, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+	return true, nil
+}
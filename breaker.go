@@ -0,0 +1,213 @@
+package gohessian
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed let calls through and counts their failures
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails calls fast until the cool-down is over
+	BreakerOpen
+	// BreakerHalfOpen let a few trial calls through to probe the endpoint
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerPolicy describe when a circuit breaker opens and closes. Only
+// transport errors count as failures, a fault proves the service is up.
+type BreakerPolicy struct {
+	// MinRequests is the number of calls in a window before the failure
+	// ratio is considered
+	MinRequests int
+	// FailureRatio in (0, 1] opens the breaker when reached
+	FailureRatio float64
+	// Window is the period after which counts of a closed breaker are reset,
+	// zero never resets them
+	Window time.Duration
+	// CoolDown is how long the breaker stays open before half-open
+	CoolDown time.Duration
+	// HalfOpenRequests is the number of concurrent trial calls when
+	// half-open, defaults to 1
+	HalfOpenRequests int
+}
+
+// CircuitOpenError is returned without calling the service when the
+// breaker of the endpoint and method is open
+type CircuitOpenError struct {
+	Endpoint string
+	Method   string
+	RetryAt  time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s %s until %s",
+		e.Endpoint, e.Method, e.RetryAt.Format(time.RFC3339))
+}
+
+// BreakerStatus is a snapshot of a circuit breaker
+type BreakerStatus struct {
+	Endpoint string
+	Method   string
+	State    BreakerState
+	Requests int
+	Failures int
+}
+
+// WithCircuitBreaker guard every endpoint and method pair of the client
+// with a circuit breaker
+func WithCircuitBreaker(p BreakerPolicy) Option {
+	return func(c *Client) {
+		if p.HalfOpenRequests <= 0 {
+			p.HalfOpenRequests = 1
+		}
+		c.breakers = &breakerSet{policy: p, m: make(map[breakerKey]*breaker)}
+	}
+}
+
+// BreakerStatus return the state of every circuit breaker of the client
+func (c *Client) BreakerStatus() []BreakerStatus {
+	if c.breakers == nil {
+		return nil
+	}
+	return c.breakers.status(time.Now())
+}
+
+type breakerKey struct {
+	endpoint string
+	method   string
+}
+
+type breakerSet struct {
+	policy BreakerPolicy
+	mu     sync.Mutex
+	m      map[breakerKey]*breaker
+}
+
+// get return the breaker of endpoint and method, create it if needed
+func (s *breakerSet) get(endpoint, method string) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := breakerKey{endpoint, method}
+	b, ok := s.m[k]
+	if !ok {
+		b = &breaker{key: k, policy: s.policy}
+		s.m[k] = b
+	}
+	return b
+}
+
+func (s *breakerSet) status(now time.Time) (st []BreakerStatus) {
+	s.mu.Lock()
+	for _, b := range s.m {
+		st = append(st, b.status(now))
+	}
+	s.mu.Unlock()
+	sort.Slice(st, func(i, j int) bool {
+		if st[i].Endpoint != st[j].Endpoint {
+			return st[i].Endpoint < st[j].Endpoint
+		}
+		return st[i].Method < st[j].Method
+	})
+	return st
+}
+
+type breaker struct {
+	key    breakerKey
+	policy BreakerPolicy
+
+	mu          sync.Mutex
+	state       BreakerState
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	trials      int // trial calls in flight when half-open
+}
+
+// currentState move an open breaker to half-open after the cool-down, the
+// lock must be held
+func (b *breaker) currentState(now time.Time) BreakerState {
+	if b.state == BreakerOpen && !now.Before(b.openedAt.Add(b.policy.CoolDown)) {
+		b.state = BreakerHalfOpen
+		b.trials = 0
+	}
+	return b.state
+}
+
+// allow return a CircuitOpenError if the call must fail fast
+func (b *breaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState(now) {
+	case BreakerClosed:
+		if b.policy.Window > 0 && now.Sub(b.windowStart) >= b.policy.Window {
+			b.requests, b.failures, b.windowStart = 0, 0, now
+		}
+		return nil
+	case BreakerHalfOpen:
+		if b.trials < b.policy.HalfOpenRequests {
+			b.trials++
+			return nil
+		}
+	}
+	return &CircuitOpenError{
+		Endpoint: b.key.endpoint,
+		Method:   b.key.method,
+		RetryAt:  b.openedAt.Add(b.policy.CoolDown),
+	}
+}
+
+// record account the result of an allowed call
+func (b *breaker) record(failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		b.trials--
+		if failed {
+			b.state, b.openedAt = BreakerOpen, now
+			return
+		}
+		b.state = BreakerClosed
+		b.requests, b.failures, b.windowStart = 0, 0, now
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.failures > 0 && b.requests >= b.policy.MinRequests &&
+			float64(b.failures) >= b.policy.FailureRatio*float64(b.requests) {
+			b.state, b.openedAt = BreakerOpen, now
+		}
+	}
+}
+
+func (b *breaker) status(now time.Time) BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStatus{
+		Endpoint: b.key.endpoint,
+		Method:   b.key.method,
+		State:    b.currentState(now),
+		Requests: b.requests,
+		Failures: b.failures,
+	}
+}
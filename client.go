@@ -2,96 +2,316 @@ package gohessian
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type hessianRequest struct {
 	body []byte
+	opts encodeOptions
+}
+
+// Option configure a Client
+type Option func(c *Client)
+
+// WithDeterministicEncoding encode requests with sorted map keys, so that
+// equal calls have the same body, see Encoder.SetDeterministic
+func WithDeterministicEncoding() Option {
+	return func(c *Client) {
+		c.encoding.deterministic = true
+	}
+}
+
+// WithStrictEncoding fail calls with params which can't be encoded without
+// loss, like uint64 above the long range or times finer than milliseconds,
+// see Encoder.SetStrict
+func WithStrictEncoding() Option {
+	return func(c *Client) {
+		c.encoding.strict = true
+	}
+}
+
+// WithHessian2 send calls in hessian 2.0, see Encoder.SetHessian2. Replies
+// are decoded in the version the service answers.
+func WithHessian2() Option {
+	return func(c *Client) {
+		c.encoding.hessian2 = true
+	}
+}
+
+// WithTypedValues decode replies with Hessian.TypedValues, keeping the java
+// types of lists and unregistered maps as TypedList and TypedMap
+func WithTypedValues() Option {
+	return func(c *Client) {
+		c.typedValues = true
+	}
+}
+
+// WithLocation decode the dates of replies in loc, see Hessian.Location
+func WithLocation(loc *time.Location) Option {
+	return func(c *Client) {
+		c.location = loc
+	}
+}
+
+// WithInterceptors append interceptors to the client, they wrap every call
+// in the given order, the first one is the outermost
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
 }
 
 // NewClient return a client for hessian
-func NewClient(host, url string) (c *Client) {
+func NewClient(host, url string, opts ...Option) (c *Client) {
 	host = HostCheck(host)
-	return &Client{
+	c = &Client{
 		Host: host,
 		URL:  url,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewMultiClient return a client for a hessian service served by several
+// hosts under the same url. Every call is sent to one endpoint chosen by the
+// balancer and fails over to the next one on transport errors.
+func NewMultiClient(hosts []string, url string, opts ...Option) (c *Client) {
+	c = &Client{URL: url}
+	for _, host := range hosts {
+		c.endpoints = append(c.endpoints, &Endpoint{Host: HostCheck(host), URL: url})
+	}
+	if len(c.endpoints) > 0 {
+		c.Host = c.endpoints[0].Host
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.balancer == nil {
+		c.balancer = RoundRobin()
+	}
+	return c
 }
 
 // String format hessian client request location
-func (c Client) String() string {
+func (c *Client) String() string {
+	if len(c.endpoints) > 0 {
+		locations := make([]string, len(c.endpoints))
+		for i, e := range c.endpoints {
+			locations[i] = e.String()
+		}
+		return strings.Join(locations, ",")
+	}
 	return c.Host + c.URL
 }
 
 // Invoke send a request to hessian service and return the result of response
 func (c *Client) Invoke(method string, params ...interface{}) (interface{}, error) {
-	reqURL := c.Host + c.URL
-	r := &hessianRequest{}
-	r.packHead(method)
-	for _, v := range params {
-		r.packParam(v)
+	return c.InvokeContext(context.Background(), method, params...)
+}
+
+// InvokeContext is like Invoke, the request is bound to ctx and passes
+// through the interceptors of the client
+func (c *Client) InvokeContext(ctx context.Context, method string, params ...interface{}) (interface{}, error) {
+	v, err := c.call(ctx, method, params)
+	if err != nil {
+		return nil, err
 	}
-	r.packEnd()
 
-	resp, err := httpPost(reqURL, bytes.NewReader(r.body))
+	c.replyMu.Lock()
+	c.replyMap = v
+	c.replyMu.Unlock()
+	return v, nil
+}
+
+// call invoke method through the interceptors of the client
+func (c *Client) call(ctx context.Context, method string, params []interface{}) (interface{}, error) {
+	return chain(c.invoke, c.interceptors)(ctx, method, params)
+}
+
+// invoke pack the request, post it and parse the response
+func (c *Client) invoke(ctx context.Context, method string, params []interface{}) (interface{}, error) {
+	body, err := c.requestBody(method, params)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(body)
+
+	rc, err := c.post(ctx, method, body, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ioutil.ReadAll(rc) // buffered already
 	if err != nil {
-		fmt.Println("got hessian service response failed:", err)
 		return nil, err
 	}
-	fmt.Println("got hessian service response success")
 
 	if len(resp) == 0 {
 		return nil, errors.New("method or params error, resp is null")
 	}
 
-	h := NewHessian(bytes.NewReader(resp))
-	v, err := h.Parse()
-
+	v, err := c.newHessian(bytes.NewReader(resp)).Parse()
 	if err != nil {
-		fmt.Println("hessian parse error", err)
 		return nil, err
 	}
-
-	c.replyMap = v
 	return v, nil
 }
 
-// BindResult bind reply to v, v must be a pointer
+// newHessian return a decoder of a reply configured by the client options
+func (c *Client) newHessian(r io.Reader) *Hessian {
+	h := NewHessian(r)
+	h.TypedValues = c.typedValues
+	h.Location = c.location
+	return h
+}
+
+// post send body to the service, failing over between endpoints if any.
+// A body which is not a *bytes.Reader is streamed and sent to a single
+// endpoint. The response is read into memory if buffered, the caller must
+// close it.
+func (c *Client) post(ctx context.Context, method string, body io.Reader, buffered bool) (rc io.ReadCloser, err error) {
+	if len(c.endpoints) == 0 {
+		return c.send(ctx, c.Host+c.URL, method, body, buffered)
+	}
+
+	replay, replayable := body.(*bytes.Reader)
+	sent := false
+	err = ErrNoEndpoint
+	tried := make(map[*Endpoint]bool, len(c.endpoints))
+	for e := c.pick(tried); e != nil; e = c.pick(tried) {
+		if sent && !replayable {
+			return nil, err
+		}
+		if replayable {
+			replay.Seek(0, io.SeekStart)
+		}
+		tried[e] = true
+		atomic.AddInt64(&e.outstanding, 1)
+		rc, err = c.send(ctx, e.String(), method, body, buffered)
+		atomic.AddInt64(&e.outstanding, -1)
+		if _, open := err.(*CircuitOpenError); open {
+			continue
+		}
+		sent = true
+		e.report(err, c.health, time.Now())
+		if Classify(err) != ClassTransport {
+			return rc, err
+		}
+	}
+	return nil, err
+}
+
+// send post body to location, guarded by the circuit breaker if any
+func (c *Client) send(ctx context.Context, location, method string, body io.Reader, buffered bool) (rc io.ReadCloser, err error) {
+	post := func() (io.ReadCloser, error) {
+		rc, err := httpPost(ctx, location, body)
+		if err != nil || !buffered {
+			return rc, err
+		}
+		defer rc.Close()
+		rb, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(rb)), nil
+	}
+	if c.breakers == nil {
+		return post()
+	}
+	b := c.breakers.get(location, method)
+	if err = b.allow(time.Now()); err != nil {
+		return nil, err
+	}
+	rc, err = post()
+	b.record(Classify(err) == ClassTransport, time.Now())
+	return rc, err
+}
+
+// BindResult bind reply of the last Invoke to v, v must be a pointer. The
+// client is safe for concurrent calls, but then the last reply may be of any
+// of them, bind the reply returned by Invoke with Bind instead.
 func (c *Client) BindResult(v interface{}) error {
+	if err := checkBindTarget(v); err != nil {
+		return err
+	}
+
+	c.replyMu.Lock()
+	defer c.replyMu.Unlock()
+	data, err := extractData(reflect.ValueOf(c.replyMap), reflect.TypeOf(v))
+	if err != nil {
+		return err
+	}
+	c.replyData = data
+	reflect.ValueOf(v).Elem().Set(c.replyData.Elem())
+	return nil
+}
+
+// Bind bind a reply returned by a call to v, v must be a pointer
+func Bind(reply interface{}, v interface{}) error {
+	if err := checkBindTarget(v); err != nil {
+		return err
+	}
+
+	data, err := extractData(reflect.ValueOf(reply), reflect.TypeOf(v))
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(v).Elem().Set(data.Elem())
+	return nil
+}
+
+// checkBindTarget check v is a non nil pointer
+func checkBindTarget(v interface{}) error {
 	if reflect.ValueOf(v).Kind() != reflect.Ptr {
 		return errors.New("not a pointer")
 	}
 	if reflect.ValueOf(v).IsNil() {
 		return errors.New("nil pointer")
 	}
-
-	c.replyData = extractData(reflect.ValueOf(c.replyMap), reflect.TypeOf(v))
-	reflect.ValueOf(v).Elem().Set(c.replyData.Elem())
 	return nil
 }
 
-//httpPost send HTTP POST request, return bytes in body
-func httpPost(url string, body io.Reader) (rb []byte, err error) {
-	var resp *http.Response
-	if resp, err = http.Post(url, "application/binary", body); err != nil {
+//httpPost send HTTP POST request, return the body of the response which
+//the caller must close
+func httpPost(ctx context.Context, url string, body io.Reader) (rc io.ReadCloser, err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+	)
+	if req, err = http.NewRequest("POST", url, body); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/binary")
+	if resp, err = http.DefaultClient.Do(req.WithContext(ctx)); err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf(resp.Status)
-		return
+		resp.Body.Close()
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
-	defer resp.Body.Close()
-	rb, err = ioutil.ReadAll(resp.Body)
-	return
+	return resp.Body, nil
 }
 
-// packHead pack hessian request head
-func (h *hessianRequest) packHead(method string) {
+// packHead pack hessian request head, a hessian 2.0 call has the number of
+// params
+func (h *hessianRequest) packHead(method string, params int) {
+	if h.opts.hessian2 {
+		h.body = append(h.body, 'H', 2, 0, 'C')
+		tmp_b, _ := encodeString2(method)
+		h.body = append(h.body, tmp_b...)
+		tmp_b, _ = encodeInt2(int32(params))
+		h.body = append(h.body, tmp_b...)
+		return
+	}
 	tmp_b, _ := PackUint16(uint16(len(method)))
 	h.body = append(h.body, []byte{99, 0, 1, 109}...)
 	h.body = append(h.body, tmp_b...)
@@ -99,15 +319,24 @@ func (h *hessianRequest) packHead(method string) {
 }
 
 // packParam pack param in hessian request
-func (h *hessianRequest) packParam(p Any) {
-	tmp_b, err := Encode(p)
+func (h *hessianRequest) packParam(p Any) error {
+	tmp_b, err := h.opts.marshal(p)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	h.body = append(h.body, tmp_b...)
+	return nil
 }
 
 // packEnd pack end of hessian request
 func (h *hessianRequest) packEnd() {
-	h.body = append(h.body, 'z')
+	h.body = append(h.body, h.end()...)
+}
+
+// end return the end of the request, a hessian 2.0 call has none
+func (h *hessianRequest) end() []byte {
+	if h.opts.hessian2 {
+		return nil
+	}
+	return []byte{'z'}
 }
@@ -1,5 +1,228 @@
 package gohessian
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newReplyServer start a server which always write reply
+func newReplyServer(reply []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(reply)
+	}))
+}
+
+func Test_client_interceptor_chain(t *testing.T) {
+	srv := newReplyServer([]byte{'r', 1, 0, 'I', 0, 0, 0, 3})
+	defer srv.Close()
+
+	var order []string
+	trace := func(name string) Interceptor {
+		return func(ctx context.Context, method string, params []interface{}, next Invoker) (interface{}, error) {
+			order = append(order, name)
+			return next(ctx, method+name, params)
+		}
+	}
+	var got Invocation
+	c := NewClient(srv.URL, "/", WithInterceptors(trace("A"), trace("B"), Observe(func(inv Invocation) {
+		got = inv
+	})))
+
+	v, err := c.Invoke("add")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if v != int32(3) {
+		t.Fatalf("want 3, got %v", v)
+	}
+	if len(order) != 2 || order[0] != "A" || order[1] != "B" {
+		t.Fatalf("want [A B], got %v", order)
+	}
+	if got.Method != "addAB" || got.Reply != int32(3) || got.Err != nil {
+		t.Fatalf("unexpected invocation %+v", got)
+	}
+}
+
+// newFlakyServer start a server which response 503 for the first n requests
+func newFlakyServer(n int, reply []byte, hits *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		if *hits <= n {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(reply)
+	}))
+}
+
+func Test_client_retry(t *testing.T) {
+	var hits int
+	srv := newFlakyServer(2, []byte{'r', 1, 0, 'T'}, &hits)
+	defer srv.Close()
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Jitter:         0.5,
+		Idempotent:     []string{"get"},
+	}
+	c := NewClient(srv.URL, "/", WithRetry(policy))
+	if _, err := c.Invoke("put"); Classify(err) != ClassTransport || hits != 1 {
+		t.Fatalf("want one transport failure, got %v after %d hits", err, hits)
+	}
+
+	v, err := c.Invoke("get")
+	if err != nil || v != true || hits != 3 {
+		t.Fatalf("want true after 3 hits, got %v, %v after %d hits", v, err, hits)
+	}
+	// the reader is drained by the first attempt
+	hits = 0
+	_, err = c.Invoke("get", bytes.NewReader([]byte("data")))
+	if Classify(err) != ClassTransport || hits != 1 {
+		t.Fatalf("want one transport failure with a reader param, got %v after %d hits", err, hits)
+	}
+}
+
+func Test_client_retry_fault(t *testing.T) {
+	var hits int
+	fault := []byte{'r', 1, 0, 'f',
+		'S', 0, 4, 'c', 'o', 'd', 'e', 'S', 0, 4, 'B', 'u', 's', 'y',
+		'S', 0, 7, 'm', 'e', 's', 's', 'a', 'g', 'e', 'S', 0, 2, 'n', 'o', 'z'}
+	srv := newFlakyServer(0, fault, &hits)
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "/", WithRetry(RetryPolicy{MaxAttempts: 3, Idempotent: []string{"get"}}))
+	_, err := c.Invoke("get")
+	f, ok := err.(*Fault)
+	if !ok || f.Code != "Busy" || f.Message != "no" {
+		t.Fatalf("want fault Busy, got %v", err)
+	}
+	if hits != 1 {
+		t.Fatalf("fault must not be retried, got %d hits", hits)
+	}
+}
+
+func Test_client_failover(t *testing.T) {
+	var hits int
+	live := newFlakyServer(0, []byte{'r', 1, 0, 'T'}, &hits)
+	defer live.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	c := NewMultiClient([]string{dead.URL, live.URL}, "/",
+		WithHealthPolicy(HealthPolicy{MaxFailures: 1, ProbeAfter: time.Hour}))
+	for i := 0; i < 4; i++ {
+		if v, err := c.Invoke("get"); err != nil || v != true {
+			t.Fatalf("want true, got %v, %v", v, err)
+		}
+	}
+	if hits != 4 {
+		t.Fatalf("want 4 hits on live endpoint, got %d", hits)
+	}
+	if !c.endpoints[0].Ejected(time.Now()) || c.endpoints[1].Ejected(time.Now()) {
+		t.Fatalf("want only the dead endpoint ejected")
+	}
+
+	c = NewMultiClient([]string{dead.URL}, "/")
+	if _, err := c.Invoke("get"); Classify(err) != ClassTransport {
+		t.Fatalf("want transport error, got %v", err)
+	}
+}
+
+func Test_balancer_pick(t *testing.T) {
+	a, b := &Endpoint{Host: "a"}, &Endpoint{Host: "b"}
+	rr := RoundRobin()
+	if rr.Pick([]*Endpoint{a, b}) != a || rr.Pick([]*Endpoint{a, b}) != b || rr.Pick([]*Endpoint{a, b}) != a {
+		t.Fatalf("round robin does not cycle")
+	}
+	a.outstanding = 2
+	if LeastOutstanding().Pick([]*Endpoint{a, b}) != b {
+		t.Fatalf("want least outstanding endpoint b")
+	}
+	if e := Random().Pick([]*Endpoint{a, b}); e != a && e != b {
+		t.Fatalf("random pick unknown endpoint %v", e)
+	}
+}
+
+func Test_client_circuit_breaker(t *testing.T) {
+	var hits int
+	srv := newFlakyServer(2, []byte{'r', 1, 0, 'T'}, &hits)
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "/", WithCircuitBreaker(BreakerPolicy{
+		MinRequests:  2,
+		FailureRatio: 0.5,
+		CoolDown:     20 * time.Millisecond,
+	}))
+	c.Invoke("get")
+	c.Invoke("get")
+	_, err := c.Invoke("get")
+	if _, ok := err.(*CircuitOpenError); !ok || hits != 2 {
+		t.Fatalf("want fail fast after 2 hits, got %v after %d hits", err, hits)
+	}
+	if st := c.BreakerStatus(); len(st) != 1 || st[0].State != BreakerOpen || st[0].Method != "get" {
+		t.Fatalf("want one open breaker, got %+v", st)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if st := c.BreakerStatus(); st[0].State != BreakerHalfOpen {
+		t.Fatalf("want half-open breaker, got %v", st[0].State)
+	}
+	if v, err := c.Invoke("get"); err != nil || v != true {
+		t.Fatalf("want true, got %v, %v", v, err)
+	}
+	if st := c.BreakerStatus(); st[0].State != BreakerClosed {
+		t.Fatalf("want closed breaker, got %v", st[0].State)
+	}
+}
+
+func Test_client_go_and_batch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	// reply the length of the method name
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for m := atomic.LoadInt32(&maxInFlight); n > m && !atomic.CompareAndSwapInt32(&maxInFlight, m, n); {
+			m = atomic.LoadInt32(&maxInFlight)
+		}
+		time.Sleep(5 * time.Millisecond)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte{'r', 1, 0, 'I', 0, 0, 0, body[5]})
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "/")
+
+	call := <-c.Go(context.Background(), "abc").Done
+	var n int32
+	if call.Error != nil || Bind(call.Reply, &n) != nil || n != 3 {
+		t.Fatalf("want 3, got %v, %v", call.Reply, call.Error)
+	}
+
+	var reqs []BatchRequest
+	for _, m := range []string{"a", "bb", "ccc", "dddd", "eeeee", "ffffff"} {
+		reqs = append(reqs, BatchRequest{Method: m})
+	}
+	calls := c.Batch(context.Background(), 2, reqs...)
+	for i, call := range calls {
+		if call.Error != nil || call.Reply != int32(i+1) {
+			t.Fatalf("call %d: want %d, got %v, %v", i, i+1, call.Reply, call.Error)
+		}
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("want at most 2 calls in flight, got %d", maxInFlight)
+	}
+}
+
 //
 //import (
 //	"bytes"
@@ -68,3 +291,221 @@ package gohessian
 //	// Request(DT_H_URL,"dataInt")
 //	dtClient.Invoke("thorwException")
 //}
+
+func Test_client_stream_binary(t *testing.T) {
+	data := make([]byte, 3*CHUNK_SIZE+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	// reply the binary param of the call
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := NewHessian(r.Body)
+		head := make([]byte, 6)
+		io.ReadFull(h.reader, head)
+		h.next(int(head[5])) // method
+		br, err := h.BinaryReader()
+		if err != nil {
+			t.Errorf("error: %v", err)
+			return
+		}
+		// http/1 handlers must read the request before replying
+		param, err := ioutil.ReadAll(br)
+		if err != nil {
+			t.Errorf("error: %v", err)
+			return
+		}
+		w.Write([]byte{'r', 1, 0})
+		e := NewEncoder(w)
+		e.WriteBinaryFrom(bytes.NewReader(param))
+		w.Write([]byte{'z'})
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "/")
+
+	rc, err := c.InvokeReader(context.Background(), "echo", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("want %d bytes echoed, got %d, %v", len(data), len(got), err)
+	}
+
+	b, err := Encode(bytes.NewBufferString("ab"))
+	if err != nil || !bytes.Equal(b, []byte{'B', 0, 2, 'a', 'b'}) {
+		t.Fatalf("unexpected reader encoding %q, %v", b, err)
+	}
+}
+
+func Test_client_encode_error(t *testing.T) {
+	var hits int
+	srv := newFlakyServer(0, []byte{'r', 1, 0, 'T'}, &hits)
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "/")
+	if _, err := c.Invoke("put", make(chan int)); err == nil {
+		t.Fatalf("want error for a param which can't be encoded")
+	}
+	call := <-c.Go(context.Background(), "put", 1, func() {}).Done
+	if call.Error == nil {
+		t.Fatalf("want error for a param which can't be encoded")
+	}
+	if hits != 0 {
+		t.Fatalf("want no request sent, got %d", hits)
+	}
+}
+
+// badMarshaler fail to encode itself
+type badMarshaler struct{}
+
+var errBadMarshaler = errors.New("bad marshaler")
+
+func (badMarshaler) MarshalHessian() ([]byte, error) {
+	return nil, errBadMarshaler
+}
+
+func Test_client_marshaler_error(t *testing.T) {
+	var hits int
+	srv := newFlakyServer(0, []byte{'r', 1, 0, 'T'}, &hits)
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "/")
+	if _, err := c.Invoke("put", []interface{}{1, badMarshaler{}}); !errors.Is(err, errBadMarshaler) {
+		t.Fatalf("want marshaler error, got %v", err)
+	}
+	if _, err := c.Invoke("put", Decimal("abc")); err == nil {
+		t.Fatalf("want error for invalid decimal")
+	}
+	if hits != 0 {
+		t.Fatalf("want no request sent, got %d", hits)
+	}
+	_, err := c.Invoke("put", bytes.NewReader([]byte("data")), badMarshaler{})
+	if !errors.Is(err, errBadMarshaler) {
+		t.Fatalf("want marshaler error of a streamed request, got %v", err)
+	}
+}
+
+func Test_client_typed_values(t *testing.T) {
+	reply, _ := Encode(TypedMap{Type: "com.acme.Unknown", Entries: map[interface{}]interface{}{"a": int32(1)}})
+	srv := newReplyServer(append([]byte{'r', 1, 0}, reply...))
+	defer srv.Close()
+
+	v, err := NewClient(srv.URL, "/").Invoke("get")
+	if _, ok := v.(map[interface{}]interface{}); err != nil || !ok {
+		t.Fatalf("want untyped map, got %#v, %v", v, err)
+	}
+	v, err = NewClient(srv.URL, "/", WithTypedValues()).Invoke("get")
+	if m, ok := v.(TypedMap); err != nil || !ok || m.Type != "com.acme.Unknown" {
+		t.Fatalf("want typed map, got %#v, %v", v, err)
+	}
+}
+
+func Test_client_hessian2(t *testing.T) {
+	data := make([]byte, CHUNK_SIZE+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	// echo the last param of the call in hessian 2.0, or fail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !bytes.HasPrefix(body, []byte{'H', 2, 0, 'C'}) {
+			t.Errorf("want a hessian 2.0 call, got %q", body)
+			return
+		}
+		h := NewHessian(bytes.NewReader(body[4:]))
+		h.Hessian2 = true
+		h.TypedValues = true
+		method, _ := h.Parse()
+		argc, _ := h.Parse()
+		var arg interface{}
+		for i := int32(0); i < argc.(int32); i++ {
+			arg, _ = h.Parse()
+		}
+		if _, err := h.Parse(); err != io.EOF {
+			t.Errorf("want end of call, got %v", err)
+		}
+		w.Write([]byte{'H', 2, 0})
+		if method == "fail" {
+			w.Write([]byte{'F'})
+			arg = map[string]interface{}{"code": "ServiceException", "message": arg}
+		} else {
+			w.Write([]byte{'R'})
+		}
+		e := NewEncoder(w)
+		e.SetHessian2(true)
+		e.Encode(arg)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "/", WithHessian2(), WithTypedValues())
+
+	in := TypedList{Type: "java.util.ArrayList", Items: []interface{}{int32(1), "two", 3.5, int64(4)}}
+	v, err := c.Invoke("echo", "first", in)
+	if err != nil || !reflect.DeepEqual(v, in) {
+		t.Fatalf("want %#v, got %#v, %v", in, v, err)
+	}
+	_, err = c.Invoke("fail", "oops")
+	if f, ok := err.(*Fault); !ok || f.Code != "ServiceException" || f.Message != "oops" {
+		t.Fatalf("want fault, got %#v", err)
+	}
+
+	rc, err := c.InvokeReader(context.Background(), "echo", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("want %d bytes echoed, got %d, %v", len(data), len(got), err)
+	}
+}
+
+func Test_client_location_and_strict(t *testing.T) {
+	var hits int
+	date := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	reply, _ := Encode(date)
+	srv := newFlakyServer(0, append([]byte{'r', 1, 0}, reply...), &hits)
+	defer srv.Close()
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	v, err := NewClient(srv.URL, "/", WithLocation(loc)).Invoke("get")
+	if d, ok := v.(time.Time); err != nil || !ok || !d.Equal(date) || d.Location() != loc {
+		t.Fatalf("want %v in %v, got %#v, %v", date, loc, v, err)
+	}
+
+	c := NewClient(srv.URL, "/", WithStrictEncoding())
+	for _, p := range []interface{}{uint64(1 << 63), date.Add(time.Microsecond)} {
+		if _, err = c.Invoke("put", p); err == nil {
+			t.Fatalf("want error for lossy param %v", p)
+		}
+		if _, err = c.Invoke("put", bytes.NewReader([]byte("data")), p); err == nil {
+			t.Fatalf("want error for lossy param %v of a streamed request", p)
+		}
+	}
+	if _, err = NewClient(srv.URL, "/").Invoke("put", date.Add(time.Microsecond)); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+}
+
+func Test_client_concurrent_invoke(t *testing.T) {
+	srv := newReplyServer([]byte{'r', 1, 0, 'I', 0, 0, 0, 7})
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "/")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var r int32
+			if _, err := c.InvokeContext(context.Background(), "get"); err != nil {
+				t.Errorf("error: %v", err)
+				return
+			}
+			if err := c.BindResult(&r); err != nil || r != 7 {
+				t.Errorf("want 7, got %v, %v", r, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// file is the model of a generated file
+type file struct {
+	Package    string
+	Imports    []importSpec
+	Structs    []structDecl
+	Enums      []enumDecl
+	Services   []service
+	Marshalers []marshaler
+}
+
+type importSpec struct {
+	Name string // empty when the package name is the last path element
+	Path string
+}
+
+// structDecl is a struct generated from a java class
+type structDecl struct {
+	Name     string
+	JavaName string
+	Embeds   []string // structs of the superclass
+	Fields   []structField
+}
+
+type structField struct {
+	Name string
+	Type string
+	Tag  string // quoted hessian field name
+}
+
+// enumDecl is a string type generated from a java enum, its constants are
+// registered with RegisterEnum
+type enumDecl struct {
+	Name      string
+	JavaName  string
+	Constants []enumConst
+}
+
+type enumConst struct {
+	Name  string // go constant
+	Value string // java constant
+}
+
+// service is an interface for which a typed client is generated
+type service struct {
+	Name    string
+	Declare bool // generate the interface too
+	Methods []method
+}
+
+type method struct {
+	Name       string
+	Wire       string // hessian method name
+	HasContext bool
+	Params     []param
+	Result     string // empty when the method return only an error
+}
+
+type param struct {
+	Name string
+	Type string
+}
+
+var wireNameRe = regexp.MustCompile(`hessian:"([^"]+)"`)
+
+// parseGoDir find the interfaces named types in the go files of dir
+func parseGoDir(dir string, types []string) (*file, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &file{}
+	imports := make(map[string]importSpec)
+	for _, name := range types {
+		found := false
+		for _, pkg := range pkgs {
+			for _, af := range pkg.Files {
+				it := findInterface(af, name)
+				if it == nil {
+					continue
+				}
+				s, used, err := parseService(fset, name, it)
+				if err != nil {
+					return nil, err
+				}
+				for _, spec := range af.Imports {
+					is := newImportSpec(spec)
+					if used[is.localName()] {
+						imports[is.Path] = is
+					}
+				}
+				f.Package = pkg.Name
+				f.Services = append(f.Services, s)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("interface %s not found in %s", name, dir)
+		}
+	}
+	for _, is := range imports {
+		f.Imports = append(f.Imports, is)
+	}
+	sort.Slice(f.Imports, func(i, j int) bool { return f.Imports[i].Path < f.Imports[j].Path })
+	return f, nil
+}
+
+// findInterface return the interface declared as name in af
+func findInterface(af *ast.File, name string) *ast.InterfaceType {
+	for _, decl := range af.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if it, ok := ts.Type.(*ast.InterfaceType); ok && ts.Name.Name == name {
+				return it
+			}
+		}
+	}
+	return nil
+}
+
+// parseService build the service of interface it, used collects the package
+// names referred by the method signatures
+func parseService(fset *token.FileSet, name string, it *ast.InterfaceType) (s service, used map[string]bool, err error) {
+	s.Name = name
+	used = make(map[string]bool)
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return s, nil, fmt.Errorf("%s: embedded interfaces are not supported", name)
+		}
+		m := method{Name: field.Names[0].Name, Wire: lowerCamel(field.Names[0].Name)}
+		for _, cg := range []*ast.CommentGroup{field.Doc, field.Comment} {
+			if sm := wireNameRe.FindStringSubmatch(cg.Text()); sm != nil {
+				m.Wire = sm[1]
+			}
+		}
+
+		for i, p := range ft.Params.List {
+			typ := exprString(fset, p.Type)
+			collectPackages(p.Type, used)
+			if i == 0 && typ == "context.Context" && len(p.Names) <= 1 {
+				m.HasContext = true
+				continue
+			}
+			if len(p.Names) == 0 {
+				m.Params = append(m.Params, param{Name: "p" + strconv.Itoa(len(m.Params)), Type: typ})
+			}
+			for _, n := range p.Names {
+				name := paramName(n.Name)
+				if name == "_" {
+					name = "p" + strconv.Itoa(len(m.Params))
+				}
+				m.Params = append(m.Params, param{Name: name, Type: typ})
+			}
+		}
+
+		var results []string
+		if ft.Results != nil {
+			for _, r := range ft.Results.List {
+				collectPackages(r.Type, used)
+				n := len(r.Names)
+				if n == 0 {
+					n = 1
+				}
+				for i := 0; i < n; i++ {
+					results = append(results, exprString(fset, r.Type))
+				}
+			}
+		}
+		if len(results) == 0 || len(results) > 2 || results[len(results)-1] != "error" {
+			return s, nil, fmt.Errorf("%s.%s: must return (T, error) or error", name, m.Name)
+		}
+		if len(results) == 2 {
+			m.Result = results[0]
+		}
+		s.Methods = append(s.Methods, m)
+	}
+	used["context"] = true
+	return s, used, nil
+}
+
+// paramName rename parameters which collide with names of the generated code
+func paramName(name string) string {
+	switch name {
+	case "c", "ctx", "reply", "err", "r":
+		return name + "Arg"
+	}
+	return name
+}
+
+// collectPackages record the package names referred in expr
+func collectPackages(expr ast.Expr, used map[string]bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if se, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := se.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+func newImportSpec(spec *ast.ImportSpec) importSpec {
+	is := importSpec{}
+	is.Path, _ = strconv.Unquote(spec.Path.Value)
+	if spec.Name != nil {
+		is.Name = spec.Name.Name
+	}
+	return is
+}
+
+// localName return the name the import is referred by
+func (is importSpec) localName() string {
+	if is.Name != "" {
+		return is.Name
+	}
+	return path.Base(is.Path)
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, fset, expr)
+	return b.String()
+}
+
+// lowerCamel lower the first letter of name
+func lowerCamel(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`// Code generated by hessiangen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- if .Marshalers}}
+	"bytes"
+{{- end}}
+{{- if .Services}}
+	"context"
+{{- end}}
+{{- range .Imports}}{{if ne .Path "context"}}
+	{{.Name}} "{{.Path}}"{{end}}{{end}}
+
+	gohessian "github.com/MenInBack/gohessian"
+)
+{{range .Structs}}
+// {{.Name}} is generated from {{.JavaName}}
+type {{.Name}} struct {
+	Name gohessian.HessianName ` + "`hs:\"{{.JavaName}}\"`" + `
+{{- range .Embeds}}
+	{{.}}
+{{- end}}
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`hs:{{.Tag}}`" + `
+{{- end}}
+}
+{{end}}
+{{- range $e := .Enums}}
+// {{$e.Name}} is generated from the java enum {{$e.JavaName}}
+type {{$e.Name}} string
+
+// constants of {{$e.JavaName}}
+const (
+{{- range $e.Constants}}
+	{{.Name}} {{$e.Name}} = {{printf "%q" .Value}}
+{{- end}}
+)
+
+func init() {
+	gohessian.RegisterEnum({{printf "%q" $e.JavaName}}{{range $e.Constants}}, {{.Name}}{{end}})
+}
+{{end}}
+{{range $s := .Services}}
+{{- if $s.Declare}}
+// {{$s.Name}} is generated from a java interface
+type {{$s.Name}} interface {
+{{- range $s.Methods}}
+	{{.Name}}(ctx context.Context{{range .Params}}, {{.Name}} {{.Type}}{{end}}) ({{if .Result}}{{.Result}}, {{end}}error)
+{{- end}}
+}
+{{end}}
+// {{$s.Name}}Client is a typed hessian client of {{$s.Name}}
+type {{$s.Name}}Client struct {
+	Client *gohessian.Client
+}
+
+// New{{$s.Name}}Client return a typed hessian client of {{$s.Name}}
+func New{{$s.Name}}Client(c *gohessian.Client) *{{$s.Name}}Client {
+	return &{{$s.Name}}Client{Client: c}
+}
+
+var _ {{$s.Name}} = (*{{$s.Name}}Client)(nil)
+{{range $m := $s.Methods}}
+// {{$m.Name}} call hessian method {{$m.Wire}}
+func (c *{{$s.Name}}Client) {{$m.Name}}({{if $m.HasContext}}ctx context.Context{{range $m.Params}}, {{.Name}} {{.Type}}{{end}}{{else}}{{range $i, $p := $m.Params}}{{if $i}}, {{end}}{{$p.Name}} {{$p.Type}}{{end}}{{end}}) ({{if $m.Result}}{{$m.Result}}, {{end}}error) {
+{{- if not $m.HasContext}}
+	ctx := context.Background()
+{{- end}}
+{{- if $m.Result}}
+	reply, err := c.Client.InvokeContext(ctx, {{printf "%q" $m.Wire}}{{range $m.Params}}, {{.Name}}{{end}})
+	var r {{$m.Result}}
+	if err != nil {
+		return r, err
+	}
+	err = gohessian.Bind(reply, &r)
+	return r, err
+{{- else}}
+	_, err := c.Client.InvokeContext(ctx, {{printf "%q" $m.Wire}}{{range $m.Params}}, {{.Name}}{{end}})
+	return err
+{{- end}}
+}
+{{end}}{{end}}` + marshalTemplate))
+
+// generate render f as formatted go source
+func generate(f *file) ([]byte, error) {
+	var b bytes.Buffer
+	if err := fileTemplate.Execute(&b, f); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated source: %v\n%s", err, b.Bytes())
+	}
+	return src, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const dataTypeSrc = `package example
+
+import (
+	"context"
+	"time"
+)
+
+type DataType interface {
+	SendInt(ctx context.Context, v int32) (int32, error) // hessian:"dataInt"
+	SendDate(t time.Time) (time.Time, error)
+	Ping(context.Context) error
+}
+`
+
+func Test_generate_client(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hessiangen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "datatype.go"), []byte(dataTypeSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parseGoDir(dir, []string{"DataType"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	src, err := generate(f)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), "", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+
+	for _, want := range []string{
+		`func (c *DataTypeClient) SendInt(ctx context.Context, v int32) (int32, error) {`,
+		`c.Client.InvokeContext(ctx, "dataInt", v)`,
+		`func (c *DataTypeClient) SendDate(t time.Time) (time.Time, error) {`,
+		`c.Client.InvokeContext(ctx, "sendDate", t)`,
+		`func (c *DataTypeClient) Ping(ctx context.Context) error {`,
+		`"time"`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Fatalf("want %s in generated source:\n%s", want, src)
+		}
+	}
+}
+
+const orderStructSrc = `package example
+
+import (
+	"time"
+
+	gohessian "github.com/MenInBack/gohessian"
+)
+
+type Order struct {
+	Name    gohessian.HessianName ` + "`hs:\"com.acme.Order\"`" + `
+	ID      int64                 ` + "`hs:\"id\"`" + `
+	Created time.Time
+	Items   []Item
+	Note    string   ` + "`hs:\"note,omitempty\"`" + `
+	Count   int32    ` + "`hs:\"count,long\"`" + `
+	Tags    []string ` + "`hs:\"tags,omitempty,list=java.util.ArrayList\"`" + `
+}
+`
+
+func Test_generate_marshaler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hessiangen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "order.go"), []byte(orderStructSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parseStructDir(dir, []string{"Order"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	src, err := generate(f)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	for _, want := range []string{
+		`e.WriteMapBegin(gohessian.ClassName(v, "com.acme.Order"))`,
+		`e.WriteString("id")`,
+		`e.WriteInt64(v.ID)`,
+		`e.WriteTime(v.Created)`,
+		`e.Encode(v.Items)`,
+		`case "id", "ID":`,
+		`v.Created, err = gohessian.ToTime(x)`,
+		`err = gohessian.Bind(x, &v.Items)`,
+		`case *Order:`,
+		`m, err := gohessian.ToMap(data)`,
+		`if v.Note != "" {`,
+		`e.WriteField("count", v.Count, "long")`,
+		`e.WriteField("tags", v.Tags, "omitempty,list=java.util.ArrayList")`,
+		`err = gohessian.Bind(x, &v.Count)`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Fatalf("want %s in generated source:\n%s", want, src)
+		}
+	}
+
+	bad := strings.Replace(orderStructSrc, "note,omitempty", "note,omitnil", 1)
+	if err = ioutil.WriteFile(filepath.Join(dir, "order.go"), []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseStructDir(dir, []string{"Order"}); err == nil {
+		t.Fatalf("want error for invalid tag option")
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// javaType is a top level class, interface or enum declared in a java source
+type javaType struct {
+	Package   string
+	Name      string
+	Interface bool
+	Enum      bool
+	Extends   string   // superclass of a class
+	Fields    []javaMember
+	Methods   []javaMember
+	Constants []string // constants of an enum
+}
+
+// javaMember is a field, or a method with its params
+type javaMember struct {
+	Name   string
+	Type   string // field type or method return type
+	Params []javaMember
+}
+
+var (
+	javaCommentRe    = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+	javaLiteralRe    = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	javaAnnotationRe = regexp.MustCompile(`@[\w.]+(\s*\([^()]*\))?`)
+	javaPackageRe    = regexp.MustCompile(`\bpackage\s+([\w.]+)\s*;`)
+	javaTypeRe       = regexp.MustCompile(`\b(class|interface|enum)\s+(\w+)([^{]*)\{`)
+	javaExtendsRe    = regexp.MustCompile(`\bextends\s+([\w.]+)`)
+	javaConstantRe   = regexp.MustCompile(`^\s*(\w+)`)
+	javaModifiers    = map[string]bool{
+		"public": true, "protected": true, "private": true, "abstract": true,
+		"final": true, "volatile": true, "synchronized": true, "native": true,
+		"default": true, "strictfp": true,
+	}
+)
+
+// parseJavaFile parse the top level classes, interfaces and enums of a java
+// source
+func parseJavaFile(name string) ([]*javaType, error) {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseJava(string(src))
+}
+
+func parseJava(src string) (types []*javaType, err error) {
+	src = javaCommentRe.ReplaceAllString(src, " ")
+	src = javaLiteralRe.ReplaceAllString(src, `""`)
+	src = javaAnnotationRe.ReplaceAllString(src, " ")
+
+	pkg := ""
+	if sm := javaPackageRe.FindStringSubmatch(src); sm != nil {
+		pkg = sm[1]
+	}
+	for pos := 0; pos < len(src); {
+		loc := javaTypeRe.FindStringSubmatchIndex(src[pos:])
+		if loc == nil {
+			break
+		}
+		kind, name := src[pos+loc[2]:pos+loc[3]], src[pos+loc[4]:pos+loc[5]]
+		header := src[pos+loc[6] : pos+loc[7]] // type params, extends and implements
+		bodyStart := pos + loc[1]
+		bodyEnd := matchBrace(src, bodyStart)
+		if bodyEnd < 0 {
+			return nil, fmt.Errorf("%s: unbalanced braces", name)
+		}
+		pos = bodyEnd + 1
+		if kind == "enum" {
+			t := &javaType{Package: pkg, Name: name, Enum: true}
+			if t.Constants = enumConstants(src[bodyStart:bodyEnd]); len(t.Constants) == 0 {
+				return nil, fmt.Errorf("%s: enum without constant", name)
+			}
+			types = append(types, t)
+			continue
+		}
+
+		t := &javaType{Package: pkg, Name: name, Interface: kind == "interface"}
+		if sm := javaExtendsRe.FindStringSubmatch(stripTypeArgs(header)); sm != nil && !t.Interface {
+			t.Extends = sm[1]
+		}
+		for _, stmt := range memberStatements(src[bodyStart:bodyEnd]) {
+			decl := stmt
+			if i := strings.Index(decl, "="); i >= 0 {
+				decl = decl[:i] // field initializer
+			}
+			if strings.Contains(decl, "(") {
+				if t.Interface {
+					m, err := parseJavaMethod(stmt)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %v", name, err)
+					}
+					t.Methods = append(t.Methods, m)
+				}
+				continue
+			}
+			if !t.Interface {
+				t.Fields = append(t.Fields, parseJavaFields(stmt)...)
+			}
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// enumConstants return the names of the constants of an enum body, which
+// come before the first ';', with their arguments and bodies
+func enumConstants(body string) (names []string) {
+	depth, start := 0, 0
+	for i := 0; i <= len(body); i++ {
+		c := byte(';')
+		if i < len(body) {
+			c = body[i]
+		}
+		switch c {
+		case '(', '{':
+			depth++
+		case ')', '}':
+			depth--
+		case ',', ';':
+			if depth > 0 {
+				continue
+			}
+			if sm := javaConstantRe.FindStringSubmatch(body[start:i]); sm != nil {
+				names = append(names, sm[1])
+			}
+			if c == ';' {
+				return
+			}
+			start = i + 1
+		}
+	}
+	return
+}
+
+// matchBrace return the index of the brace closing the one before start
+func matchBrace(src string, start int) int {
+	depth := 1
+	for i := start; i < len(src); i++ {
+		switch src[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// memberStatements split a class body into the statements ending with ';',
+// skipping method bodies, initializers and nested types
+func memberStatements(body string) (stmts []string) {
+	var cur strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '{':
+			end := matchBrace(body, i+1)
+			if end < 0 {
+				return
+			}
+			i = end
+			cur.Reset()
+		case ';':
+			if s := strings.TrimSpace(cur.String()); s != "" {
+				stmts = append(stmts, s)
+			}
+			cur.Reset()
+		default:
+			cur.WriteByte(body[i])
+		}
+	}
+	return
+}
+
+// parseJavaFields parse a field declaration, static and transient fields
+// are not serialized and are skipped
+func parseJavaFields(stmt string) (fields []javaMember) {
+	if i := strings.Index(stmt, "="); i >= 0 {
+		stmt = stmt[:i]
+	}
+	words := strings.Fields(stmt)
+	for len(words) > 0 && javaModifiers[words[0]] {
+		words = words[1:]
+	}
+	for _, w := range words {
+		if w == "static" || w == "transient" {
+			return nil
+		}
+	}
+	declarators := splitTopLevel(strings.Join(words, " "))
+	typ, name := splitTypeName(declarators[0])
+	if name == "" {
+		return nil
+	}
+	fields = append(fields, javaMember{Name: name, Type: typ})
+	for _, d := range declarators[1:] {
+		fields = append(fields, javaMember{Name: strings.TrimSpace(d), Type: typ})
+	}
+	return fields
+}
+
+// parseJavaMethod parse an interface method declaration
+func parseJavaMethod(stmt string) (m javaMember, err error) {
+	open, close := strings.Index(stmt, "("), strings.LastIndex(stmt, ")")
+	if close < open {
+		return m, fmt.Errorf("invalid method %q", stmt)
+	}
+	words := strings.Fields(stmt[:open])
+	for len(words) > 0 && (javaModifiers[words[0]] || words[0] == "static") {
+		words = words[1:]
+	}
+	if len(words) > 0 && strings.HasPrefix(words[0], "<") {
+		return m, fmt.Errorf("generic method %q is not supported", stmt)
+	}
+	m.Type, m.Name = splitTypeName(strings.Join(words, " "))
+	if m.Name == "" {
+		return m, fmt.Errorf("invalid method %q", stmt)
+	}
+	params := strings.TrimSpace(stmt[open+1 : close])
+	if params == "" {
+		return m, nil
+	}
+	for _, p := range splitTopLevel(params) {
+		words := strings.Fields(p)
+		for len(words) > 0 && words[0] == "final" {
+			words = words[1:]
+		}
+		typ, name := splitTypeName(strings.Join(words, " "))
+		typ = strings.Replace(typ, "...", "[]", 1)
+		m.Params = append(m.Params, javaMember{Name: name, Type: typ})
+	}
+	return m, nil
+}
+
+// stripTypeArgs remove the type params and arguments of s, like <T extends Base>
+func stripTypeArgs(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, c := range s {
+		switch {
+		case c == '<':
+			depth++
+		case c == '>':
+			depth--
+		case depth == 0:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// splitTopLevel split s on the commas outside of type arguments
+func splitTopLevel(s string) (parts []string) {
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitTypeName split "Map<String, Foo> name" into its type and name
+func splitTypeName(s string) (typ, name string) {
+	s = strings.TrimSpace(s)
+	i := strings.LastIndexFunc(s, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$')
+	})
+	if i < 0 {
+		return s, ""
+	}
+	typ, name = strings.TrimSpace(s[:i+1]), s[i+1:]
+	// C style array declarators: int values[]
+	for strings.HasSuffix(name, "[]") {
+		name = strings.TrimSuffix(name, "[]")
+		typ += "[]"
+	}
+	return strings.Replace(typ, " ", "", -1), name
+}
+
+// javaToGo map a java type to its go type, dtos are the classes being
+// generated, others are mapped to interface{}
+func javaToGo(typ string, dtos map[string]bool) string {
+	if strings.HasSuffix(typ, "[]") {
+		elem := strings.TrimSuffix(typ, "[]")
+		if elem == "byte" {
+			return "[]byte"
+		}
+		return "[]" + javaToGo(elem, dtos)
+	}
+
+	base, args := typ, []string(nil)
+	if i := strings.Index(typ, "<"); i >= 0 && strings.HasSuffix(typ, ">") {
+		base, args = typ[:i], splitTopLevel(typ[i+1:len(typ)-1])
+	}
+	base = base[strings.LastIndex(base, ".")+1:]
+	arg := func(i int) string {
+		if i < len(args) {
+			return javaToGo(args[i], dtos)
+		}
+		return "interface{}"
+	}
+
+	switch base {
+	case "boolean", "Boolean":
+		return "bool"
+	case "byte", "Byte", "short", "Short", "int", "Integer":
+		return "int32"
+	case "long", "Long":
+		return "int64"
+	case "float", "Float", "double", "Double":
+		return "float64"
+	case "char", "Character", "String":
+		return "string"
+	case "BigDecimal":
+		return "gohessian.Decimal"
+	case "BigInteger":
+		return "*big.Int"
+	case "Date", "Timestamp", "Instant", "OffsetDateTime", "ZonedDateTime":
+		return "time.Time"
+	case "Duration":
+		return "time.Duration"
+	case "LocalDate", "LocalTime", "LocalDateTime":
+		return "gohessian." + base
+	case "List", "ArrayList", "LinkedList", "Collection", "Set", "HashSet", "Iterable":
+		return "[]" + arg(0)
+	case "Map", "HashMap", "LinkedHashMap", "TreeMap", "ConcurrentHashMap":
+		return "map[" + arg(0) + "]" + arg(1)
+	}
+	if dtos[base] {
+		return base
+	}
+	return "interface{}"
+}
+
+// goFieldName export a java field name, Name is taken by the HessianName field
+func goFieldName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	if string(r) == "Name" {
+		return "NameField"
+	}
+	return string(r)
+}
+
+// goConstName turn a java constant name like IN_PROGRESS into InProgress
+func goConstName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if strings.ToUpper(part) == part {
+			part = strings.ToLower(part)
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+// fromJava build the generated file of java types
+func fromJava(pkg string, types []*javaType) (*file, error) {
+	f := &file{Package: pkg}
+	dtos := make(map[string]bool)    // classes and enums
+	classes := make(map[string]bool) // superclasses which can be embedded
+	for _, t := range types {
+		if !t.Interface {
+			dtos[t.Name] = true
+		}
+		if !t.Interface && !t.Enum {
+			classes[t.Name] = true
+		}
+	}
+
+	usesTime, usesBig := false, false
+	goType := func(typ string) string {
+		g := javaToGo(typ, dtos)
+		if strings.Contains(g, "time.") {
+			usesTime = true
+		}
+		if strings.Contains(g, "big.Int") {
+			usesBig = true
+		}
+		return g
+	}
+
+	for _, t := range types {
+		javaName := t.Name
+		if t.Package != "" {
+			javaName = t.Package + "." + t.Name
+		}
+		if t.Enum {
+			e := enumDecl{Name: t.Name, JavaName: javaName}
+			for _, c := range t.Constants {
+				e.Constants = append(e.Constants, enumConst{Name: t.Name + goConstName(c), Value: c})
+			}
+			f.Enums = append(f.Enums, e)
+			continue
+		}
+		if !t.Interface {
+			s := structDecl{Name: t.Name, JavaName: javaName}
+			if base := t.Extends[strings.LastIndex(t.Extends, ".")+1:]; base != "" && base != "Object" {
+				if !classes[base] {
+					return nil, fmt.Errorf("%s: superclass %s is not among the java sources, unsupported", t.Name, t.Extends)
+				}
+				s.Embeds = append(s.Embeds, base)
+			}
+			for _, field := range t.Fields {
+				s.Fields = append(s.Fields, structField{
+					Name: goFieldName(field.Name),
+					Type: goType(field.Type),
+					Tag:  strconv.Quote(field.Name),
+				})
+			}
+			f.Structs = append(f.Structs, s)
+			continue
+		}
+
+		s := service{Name: t.Name, Declare: true}
+		seen := make(map[string]int)
+		for _, jm := range t.Methods {
+			m := method{Name: goFieldName(jm.Name), Wire: jm.Name, HasContext: true}
+			if m.Name == "NameField" {
+				m.Name = "Name"
+			}
+			// overloaded java methods share the hessian name
+			if seen[m.Name]++; seen[m.Name] > 1 {
+				m.Name += strconv.Itoa(seen[m.Name])
+			}
+			for i, p := range jm.Params {
+				name := paramName(p.Name)
+				if name == "" {
+					name = "p" + strconv.Itoa(i)
+				}
+				m.Params = append(m.Params, param{Name: name, Type: goType(p.Type)})
+			}
+			if jm.Type != "void" {
+				m.Result = goType(jm.Type)
+			}
+			s.Methods = append(s.Methods, m)
+		}
+		f.Services = append(f.Services, s)
+	}
+	if usesBig {
+		f.Imports = append(f.Imports, importSpec{Path: "math/big"})
+	}
+	if usesTime {
+		f.Imports = append(f.Imports, importSpec{Path: "time"})
+	}
+	return f, nil
+}
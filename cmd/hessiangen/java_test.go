@@ -0,0 +1,179 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const orderSrc = `package com.acme;
+
+import java.math.BigDecimal;
+import java.math.BigInteger;
+import java.util.*;
+
+/** An order */
+public class Order implements java.io.Serializable {
+	private static final long serialVersionUID = 1L;
+	private long id;
+	private String name; // "name; not a field"
+	private transient Object cache;
+	private Date created;
+	private BigDecimal amount;
+	private BigInteger serial;
+	private java.time.LocalDate shipDate;
+	private List<Item> items = new ArrayList<Item>();
+	private Map<String, List<Integer>> tags;
+	private byte[] payload;
+
+	public long getId() { return id; }
+	public void setId(long id) { this.id = id; }
+}
+
+class Item {
+	int count, weight;
+}
+
+public interface OrderService {
+	Order getOrder(long id) throws ServiceException;
+	@Deprecated
+	void save(final Order order, Map<String, Object> options);
+	List<Order> find(String... names);
+}
+`
+
+func Test_parse_java(t *testing.T) {
+	types, err := parseJava(orderSrc)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if len(types) != 3 {
+		t.Fatalf("want 3 types, got %d", len(types))
+	}
+	order := types[0]
+	if order.Package != "com.acme" || order.Name != "Order" || len(order.Fields) != 9 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	if f := order.Fields[7]; f.Name != "tags" || f.Type != "Map<String,List<Integer>>" {
+		t.Fatalf("unexpected field %+v", f)
+	}
+	if item := types[1]; len(item.Fields) != 2 || item.Fields[1].Name != "weight" || item.Fields[1].Type != "int" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+	if m := types[2].Methods[1]; m.Name != "save" || m.Type != "void" || len(m.Params) != 2 || m.Params[0].Name != "order" {
+		t.Fatalf("unexpected method %+v", m)
+	}
+}
+
+const statusSrc = `package com.acme;
+
+public class Entity {
+	protected long version;
+}
+
+public enum Status implements Labeled {
+	ACTIVE("a"), IN_PROGRESS("p") {
+		String label() { return "in progress"; }
+	},
+	DELETED;
+
+	private final String label;
+}
+
+public class Account<T extends Entity> extends com.acme.Entity {
+	private Status status;
+}
+`
+
+func Test_parse_java_enum_and_superclass(t *testing.T) {
+	types, err := parseJava(statusSrc)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if len(types) != 3 {
+		t.Fatalf("want 3 types, got %d", len(types))
+	}
+	if status := types[1]; !status.Enum || strings.Join(status.Constants, ",") != "ACTIVE,IN_PROGRESS,DELETED" {
+		t.Fatalf("unexpected enum %+v", status)
+	}
+	if account := types[2]; account.Extends != "com.acme.Entity" || len(account.Fields) != 1 {
+		t.Fatalf("unexpected account %+v", account)
+	}
+
+	f, err := fromJava("acme", types)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	src, err := generate(f)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), "", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	got := strings.Join(strings.Fields(string(src)), " ")
+	for _, want := range []string{
+		"type Status string",
+		`StatusInProgress Status = "IN_PROGRESS"`,
+		`gohessian.RegisterEnum("com.acme.Status", StatusActive, StatusInProgress, StatusDeleted)`,
+		"Name gohessian.HessianName `hs:\"com.acme.Account\"` Entity Status Status `hs:\"status\"`",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("want %s in generated source:\n%s", want, src)
+		}
+	}
+
+	types, err = parseJava("class Account extends java.util.HashMap { int id; }")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err = fromJava("acme", types); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("want unsupported superclass error, got %v", err)
+	}
+	if _, err = parseJava("enum Empty { ; }"); err == nil {
+		t.Fatalf("want error of an enum without constant")
+	}
+}
+
+func Test_generate_java(t *testing.T) {
+	types, err := parseJava(orderSrc)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	f, err := fromJava("acme", types)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	src, err := generate(f)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), "", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+
+	// compare regardless of the alignment of struct fields
+	got := strings.Join(strings.Fields(string(src)), " ")
+	for _, want := range []string{
+		"Name gohessian.HessianName `hs:\"com.acme.Order\"`",
+		"Id int64 `hs:\"id\"`",
+		"NameField string `hs:\"name\"`",
+		"Created time.Time `hs:\"created\"`",
+		"Amount gohessian.Decimal `hs:\"amount\"`",
+		"Serial *big.Int `hs:\"serial\"`",
+		"ShipDate gohessian.LocalDate `hs:\"shipDate\"`",
+		`"math/big"`,
+		"Items []Item `hs:\"items\"`",
+		"Tags map[string][]int32 `hs:\"tags\"`",
+		"Payload []byte `hs:\"payload\"`",
+		"GetOrder(ctx context.Context, id int64) (Order, error)",
+		"Save(ctx context.Context, order Order, options map[string]interface{}) error",
+		"Find(ctx context.Context, names []string) ([]Order, error)",
+		`c.Client.InvokeContext(ctx, "getOrder", id)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("want %s in generated source:\n%s", want, src)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Hessiangen generate typed hessian client stubs from Go interfaces.
+//
+// Usage:
+//
+//	//go:generate hessiangen -type DataType
+//
+// For every method of the interface the generated client calls the hessian
+// method of the same name in lower camel case, which may be overridden with
+// a comment on the method:
+//
+//	SendInt(ctx context.Context, v int32) (int32, error) // hessian:"sendInt"
+//
+// Methods must return an error as their last result and at most one other
+// value. A leading context.Context parameter is passed to the call.
+//
+// With -marshal, -type names structs instead. MarshalHessian and
+// UnmarshalHessian methods are generated for them, which the encoder and
+// Bind use instead of reflection:
+//
+//	//go:generate hessiangen -marshal -type Order,Item
+//
+// With -java, the arguments are java sources instead. Go structs are
+// generated for their classes, embedding the struct of their superclass,
+// string types registered with RegisterEnum for their enums and typed
+// clients for their interfaces:
+//
+//	hessiangen -java -package example -output example_hessian.go DataType.java Order.java
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma separated interface or struct names, required unless -java")
+	output    = flag.String("output", "", "output file name, default <type>_hessian.go")
+	marshal   = flag.Bool("marshal", false, "generate marshalers for the structs named by -type")
+	java      = flag.Bool("java", false, "generate from the java sources given as arguments")
+	pkgName   = flag.String("package", "", "package of the code generated from java, default the last element of the java package")
+)
+
+func main() {
+	log := func(err error) {
+		fmt.Fprintln(os.Stderr, "hessiangen:", err)
+		os.Exit(1)
+	}
+	flag.Parse()
+	if *java {
+		if err := generateJava(flag.Args()); err != nil {
+			log(err)
+		}
+		return
+	}
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+	types := strings.Split(*typeNames, ",")
+
+	parse := parseGoDir
+	if *marshal {
+		parse = parseStructDir
+	}
+	f, err := parse(dir, types)
+	if err != nil {
+		log(err)
+	}
+	src, err := generate(f)
+	if err != nil {
+		log(err)
+	}
+
+	name := *output
+	if name == "" {
+		name = filepath.Join(dir, strings.ToLower(types[0])+"_hessian.go")
+	}
+	if err = ioutil.WriteFile(name, src, 0644); err != nil {
+		log(err)
+	}
+}
+
+// generateJava generate go code from java source files
+func generateJava(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("no java source given")
+	}
+	var types []*javaType
+	for _, name := range names {
+		ts, err := parseJavaFile(name)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		types = append(types, ts...)
+	}
+	if len(types) == 0 {
+		return fmt.Errorf("no class or interface found")
+	}
+
+	pkg := *pkgName
+	if pkg == "" {
+		pkg = types[0].Package[strings.LastIndex(types[0].Package, ".")+1:]
+	}
+	if pkg == "" {
+		pkg = "main"
+	}
+	f, err := fromJava(pkg, types)
+	if err != nil {
+		return err
+	}
+	src, err := generate(f)
+	if err != nil {
+		return err
+	}
+
+	name := *output
+	if name == "" {
+		name = strings.ToLower(types[0].Name) + "_hessian.go"
+	}
+	return ioutil.WriteFile(name, src, 0644)
+}
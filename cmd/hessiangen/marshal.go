@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// marshaler is a struct for which MarshalHessian, WriteHessian and
+// UnmarshalHessian are generated
+type marshaler struct {
+	Name     string
+	JavaName string
+	Fields   []marshalField
+}
+
+type marshalField struct {
+	Name    string   // go field name
+	Keys    []string // quoted map keys bound to the field, the first one is encoded
+	Write   string   // Encoder method writing the field, Encode if empty
+	To      string   // conversion from the decoded value, Bind if empty
+	NonZero string   // condition to write an omitempty field, always written if empty
+	Options string   // quoted tag options written by Encoder.WriteField
+}
+
+// fieldCodecs map go types to the reflection free Encoder method and
+// conversion
+var fieldCodecs = map[string][2]string{
+	"bool":      {"WriteBool", "ToBool"},
+	"int32":     {"WriteInt32", "ToInt32"},
+	"int64":     {"WriteInt64", "ToInt64"},
+	"float64":   {"WriteFloat64", "ToFloat64"},
+	"string":    {"WriteString", "ToString"},
+	"time.Time": {"WriteTime", "ToTime"},
+	"[]byte":    {"WriteBinary", "ToBytes"},
+}
+
+// nonZero are the conditions of omitempty fields by type, as the reflection
+// based encoder checks them
+var nonZero = map[string]string{
+	"bool":    "v.%s",
+	"int32":   "v.%s != 0",
+	"int64":   "v.%s != 0",
+	"float64": "v.%s != 0",
+	"string":  `v.%s != ""`,
+	"[]byte":  "len(v.%s) != 0",
+}
+
+// parseStructDir find the structs named types in the go files of dir
+func parseStructDir(dir string, types []string) (*file, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &file{}
+	for _, name := range types {
+		found := false
+		for _, pkg := range pkgs {
+			for _, af := range pkg.Files {
+				st := findStruct(af, name)
+				if st == nil {
+					continue
+				}
+				m, err := parseMarshaler(fset, name, st)
+				if err != nil {
+					return nil, err
+				}
+				f.Package = pkg.Name
+				f.Marshalers = append(f.Marshalers, m)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("struct %s not found in %s", name, dir)
+		}
+	}
+	return f, nil
+}
+
+// findStruct return the struct declared as name in af
+func findStruct(af *ast.File, name string) *ast.StructType {
+	for _, decl := range af.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if st, ok := ts.Type.(*ast.StructType); ok && ts.Name.Name == name {
+				return st
+			}
+		}
+	}
+	return nil
+}
+
+// parseMarshaler build the marshaler of st, following the field naming of
+// the reflection based encoder
+func parseMarshaler(fset *token.FileSet, name string, st *ast.StructType) (m marshaler, err error) {
+	m.Name, m.JavaName = name, name
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return m, fmt.Errorf("%s: embedded fields are not supported", name)
+		}
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			s, _ := strconv.Unquote(field.Tag.Value)
+			tag = reflect.StructTag(s)
+		}
+		typ := exprString(fset, field.Type)
+		if strings.HasSuffix(typ, "HessianName") {
+			if field.Names[0].Name == "Name" && tag.Get("hs") != "" {
+				m.JavaName = tag.Get("hs")
+			}
+			continue
+		}
+
+		key := tag.Get("hs")
+		if key == "-" {
+			continue
+		}
+		opts := strings.Split(key, ",")
+		key = opts[0]
+		omitEmpty, hinted, err := checkTagOptions(opts[1:])
+		if err != nil {
+			return m, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, n := range field.Names {
+			if !ast.IsExported(n.Name) {
+				continue // not encoded
+			}
+			mf := marshalField{Name: n.Name, Keys: []string{strconv.Quote(n.Name)}}
+			if key != "" && key != n.Name {
+				mf.Keys = append([]string{strconv.Quote(key)}, mf.Keys...)
+			}
+			codec, ok := fieldCodecs[typ]
+			switch {
+			case hinted:
+				// converted and bound by reflection like numbers of other types
+				mf.Options = strconv.Quote(strings.Join(opts[1:], ","))
+			case omitEmpty && nonZero[typ] == "" && typ != "time.Time":
+				mf.Options = strconv.Quote("omitempty")
+			case ok:
+				mf.Write, mf.To = codec[0], codec[1]
+				if omitEmpty && nonZero[typ] != "" {
+					mf.NonZero = fmt.Sprintf(nonZero[typ], n.Name)
+				}
+			}
+			m.Fields = append(m.Fields, mf)
+		}
+	}
+	return m, nil
+}
+
+// checkTagOptions check the options of a hs tag as the encoder reads them,
+// hinted tells whether they change how the field is encoded
+func checkTagOptions(opts []string) (omitEmpty, hinted bool, err error) {
+	for _, opt := range opts {
+		switch {
+		case opt == "omitempty":
+			omitEmpty = true
+		case opt == "int", opt == "long", opt == "double",
+			strings.HasPrefix(opt, "list=") && len(opt) > len("list="),
+			strings.HasPrefix(opt, "map=") && len(opt) > len("map="):
+			hinted = true
+		default:
+			return false, false, fmt.Errorf("invalid tag option %q", opt)
+		}
+	}
+	return
+}
+
+const marshalTemplate = `{{range .Marshalers}}
+// MarshalHessian encode {{.Name}} as a map of its registered class or
+// {{.JavaName}} without reflection
+func (v {{.Name}}) MarshalHessian() ([]byte, error) {
+	var b bytes.Buffer
+	if err := v.WriteHessian(gohessian.NewEncoder(&b)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteHessian write {{.Name}} to e, with the options of e, without reflection
+func (v {{.Name}}) WriteHessian(e *gohessian.Encoder) error {
+	e.WriteMapBegin(gohessian.ClassName(v, {{printf "%q" .JavaName}}))
+{{- range .Fields}}
+{{- if .Options}}
+	e.WriteField({{index .Keys 0}}, v.{{.Name}}, {{.Options}})
+{{- else}}
+{{- if .NonZero}}
+	if {{.NonZero}} {
+{{- end}}
+	e.WriteString({{index .Keys 0}})
+{{- if .Write}}
+	e.{{.Write}}(v.{{.Name}})
+{{- else}}
+	e.Encode(v.{{.Name}})
+{{- end}}
+{{- if .NonZero}}
+	}
+{{- end}}
+{{- end}}
+{{- end}}
+	e.WriteMapEnd()
+	return e.Err()
+}
+
+// UnmarshalHessian bind a decoded map to {{.Name}} without reflection, a
+// {{.Name}} decoded as a registered type is copied
+func (v *{{.Name}}) UnmarshalHessian(data interface{}) (err error) {
+	switch d := data.(type) {
+	case {{.Name}}:
+		*v = d
+		return nil
+	case *{{.Name}}:
+		if d != nil {
+			*v = *d
+		}
+		return nil
+	}
+	m, err := gohessian.ToMap(data)
+	if err != nil {
+		return err
+	}
+	for k, x := range m {
+		switch k {
+{{- range .Fields}}
+		case {{join .Keys ", "}}:
+{{- if .To}}
+			v.{{.Name}}, err = gohessian.{{.To}}(x)
+{{- else}}
+			err = gohessian.Bind(x, &v.{{.Name}})
+{{- end}}
+{{- end}}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+{{end}}`
@@ -3,11 +3,13 @@ package gohessian
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"time"
-
-	log "github.com/cihub/seelog"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 const (
@@ -19,9 +21,12 @@ func NewHessian(r io.Reader) (h *Hessian) {
 }
 
 // peekByte read the byte and do not move the point
-func (h *Hessian) peekByte() (b byte) {
-	b = h.peek(1)[0]
-	return
+func (h *Hessian) peekByte() (b byte, err error) {
+	p, err := h.peek(1)
+	if err != nil {
+		return
+	}
+	return p[0], nil
 }
 
 // appendRefs append reference
@@ -29,76 +34,258 @@ func (h *Hessian) appendRefs(v interface{}) {
 	h.refs = append(h.refs, v)
 }
 
-// len return length of buffer
-func (h *Hessian) len() (l int) {
-	h.peek(1) // read the resources in order to get the length of buffer
-	l = h.reader.Buffered()
-	return
-}
-
 // readByte read a byte in hessian struct and move back a byte
 func (h *Hessian) readByte() (c byte, err error) {
-	c, err = h.reader.ReadByte()
+	if c, err = h.reader.ReadByte(); err == nil {
+		h.offset++
+	}
 	return
 }
 
-// next read the bytes of the specified length and move back N bytes
-func (h *Hessian) next(n int) (b []byte) {
+// next read the bytes of the specified length and move back N bytes, the
+// end of data before them is io.ErrUnexpectedEOF
+func (h *Hessian) next(n int) (b []byte, err error) {
 	if n <= 0 {
 		return
 	}
-	if n >= h.reader.Buffered() {
-		n = h.reader.Buffered()
-	}
 	b = make([]byte, n)
-	h.reader.Read(b)
-	return
+	m, err := io.ReadFull(h.reader, b) // chunks are larger than the buffer
+	h.offset += int64(m)
+	return b[:m], unexpected(err)
 }
 
 // peek read the bytes of the specified length and do not move the point
-func (h *Hessian) peek(n int) (b []byte) {
-	b, _ = h.reader.Peek(n)
-	return
+func (h *Hessian) peek(n int) (b []byte, err error) {
+	b, err = h.reader.Peek(n)
+	return b, unexpected(err)
+}
+
+// peekIs tell whether the next byte is b, false at the end of data
+func (h *Hessian) peekIs(b byte) (bool, error) {
+	p, err := h.reader.Peek(1)
+	if err == io.EOF {
+		return false, nil
+	}
+	return err == nil && p[0] == b, err
 }
 
-// nextRune reads the utf8 character of the specified length
-func (h *Hessian) nextRune(n int) (s []rune) {
-	for i := 0; i < n; i++ {
-		if r, ri, e := h.reader.ReadRune(); e == nil && ri > 0 {
-			s = append(s, r)
+// discard skip n bytes which have been peeked
+func (h *Hessian) discard(n int) {
+	m, _ := h.reader.Discard(n)
+	h.offset += int64(m)
+}
+
+// unexpected turn the end of data inside a value into io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// fail wrap err as a DecodeError of the value of tag, at the current offset
+func (h *Hessian) fail(tag byte, err error) error {
+	switch err.(type) {
+	case nil, *DecodeError, *Fault:
+		return err
+	}
+	return &DecodeError{Offset: h.offset, Tag: tag, Err: unexpected(err)}
+}
+
+// nextRune reads characters of the specified length in utf-16 code units,
+// as java and hessian count them, a rune out of the BMP counts two
+func (h *Hessian) nextRune(n int) (s []rune, err error) {
+	for i := 0; i < n; {
+		r, size, units, err := h.peekChar()
+		if err != nil {
+			return s, err
 		}
+		h.discard(size)
+		s = append(s, r)
+		i += units
 	}
 	return
 }
 
+// peekChar decode the next character of a string without reading it. A rune
+// out of the BMP is accepted as 4 bytes of utf-8 or as a surrogate pair of 3
+// bytes each, CESU-8, as java writes it. size is the number of bytes of the
+// character and units its number of utf-16 code units.
+func (h *Hessian) peekChar() (r rune, size, units int, err error) {
+	p, err := h.reader.Peek(6) // shorter at the end
+	if len(p) == 0 || !utf8.FullRune(p) {
+		return utf8.RuneError, 0, 0, unexpected(err)
+	}
+	r, size = utf8.DecodeRune(p)
+	hi, ok := surrogate(p)
+	if !ok {
+		return r, size, utf16Len(r), nil
+	}
+	if cut := p[3:]; len(p) < 6 && err != nil && hi < 0xdc00 &&
+		(len(cut) == 0 || cut[0] == 0xed && (len(cut) == 1 || cut[1] >= 0xb0)) {
+		return utf8.RuneError, 0, 0, unexpected(err) // the pair is cut
+	}
+	if lo, ok := surrogate(p[3:]); ok && utf16.IsSurrogate(hi) && hi < 0xdc00 && lo >= 0xdc00 {
+		return utf16.DecodeRune(hi, lo), 6, 2, nil
+	}
+	return utf8.RuneError, 3, 1, nil // unpaired surrogate
+}
+
+// surrogate decode the 3 bytes encoding of a surrogate code unit at the
+// start of p
+func surrogate(p []byte) (rune, bool) {
+	if len(p) < 3 || p[0] != 0xed || p[1] < 0xa0 || p[1] > 0xbf || p[2] < 0x80 || p[2] > 0xbf {
+		return 0, false
+	}
+	return rune(p[0]&0x0f)<<12 | rune(p[1]&0x3f)<<6 | rune(p[2]&0x3f), true
+}
+
+// location return the location of decoded times
+func (h *Hessian) location() *time.Location {
+	if h.Location == nil {
+		return time.Local
+	}
+	return h.Location
+}
+
 // readType read the type of data for list and map
-func (h *Hessian) readType() string {
-	if h.peekByte() != 't' {
-		return ""
+func (h *Hessian) readType() (string, error) {
+	if ok, err := h.peekIs('t'); !ok || err != nil {
+		return "", err
 	}
-	tLen, _ := UnpackInt16(h.peek(3)[1:3]) // take the length of type name
-	tName := h.nextRune(int(3 + tLen))[3:] // take the type name
-	return string(tName)
+	h.discard(1)
+	l, err := h.nextLength() // take the length of type name
+	if err != nil {
+		return "", err
+	}
+	name, err := h.nextRune(l) // take the type name
+	return string(name), err
 }
 
-// Parse hessian data
+// nextLength read the 2 bytes length of a chunk or a type name
+func (h *Hessian) nextLength() (int, error) {
+	b, err := h.next(2)
+	if err != nil {
+		return 0, err
+	}
+	l, err := UnpackUint16(b)
+	return int(l), err
+}
+
+// typedList return a decoded list of java type typ, as a slice of the
+// registered element type or a TypedList
+func (h *Hessian) typedList(typ string, items []interface{}) (interface{}, error) {
+	if elem, ok := registeredElem(typ); ok {
+		return instantiateList(items, elem)
+	}
+	if h.TypedValues && typ != "" {
+		return TypedList{Type: typ, Items: items}, nil
+	}
+	return items, nil
+}
+
+// typedMap return a decoded map of java class typ, as a java.time value, an
+// enum constant, a registered type or a TypedMap
+func (h *Hessian) typedMap(typ string, entries map[interface{}]interface{}) (interface{}, error) {
+	if dec, ok := javaTimeClass(typ); ok {
+		return dec(entries, h.location())
+	}
+	if en, ok := lookupEnumClass(typ); ok {
+		c, err := en.constant(entries)
+		if err != nil {
+			return nil, err
+		}
+		return c.Interface(), nil
+	}
+	if rt, ok := registeredType(typ); ok {
+		return instantiate(entries, rt)
+	}
+	if h.TypedValues && typ != "" {
+		return TypedMap{Type: typ, Entries: entries}, nil
+	}
+	return entries, nil
+}
+
+// mapKey return the decoded key of a map of tag, read at offset. Binary keys
+// are strings, other keys which can't be hashed, like lists and maps, are a
+// *DecodeError.
+func mapKey(key interface{}, offset int64, tag byte) (interface{}, error) {
+	if b, ok := key.([]byte); ok {
+		return string(b), nil
+	}
+	if key != nil && !reflect.TypeOf(key).Comparable() {
+		return nil, &DecodeError{Offset: offset, Tag: tag, Err: fmt.Errorf("invalid map key %T", key)}
+	}
+	return key, nil
+}
+
+// nextChunk read the tag of the chunk after a chunk of tag t, which must be
+// of the same kind
+func (h *Hessian) nextChunk(t byte) (next byte, err error) {
+	if next, err = h.readByte(); err != nil {
+		return
+	}
+	if next|0x20 != t|0x20 {
+		err = fmt.Errorf("invalid chunk %q after %q", next, t)
+	}
+	return
+}
+
+// Parse hessian data. io.EOF is returned when there is no more value, a
+// short read or invalid data is returned as *DecodeError.
 func (h *Hessian) Parse() (v interface{}, err error) {
 	t, err := h.readByte()
 	if err == io.EOF {
 		return
 	}
+	if err != nil {
+		return nil, h.fail(0, err)
+	}
+	if h.Hessian2 {
+		v, err = h.parse2(t)
+	} else {
+		v, err = h.parse(t)
+	}
+	if err != nil {
+		return nil, h.fail(t, err)
+	}
+	return
+}
+
+// parseItem parse a value inside the value of tag, which can't end before it
+func (h *Hessian) parseItem(tag byte) (interface{}, error) {
+	v, err := h.Parse()
+	if err == io.EOF {
+		err = h.fail(tag, err)
+	}
+	return v, err
+}
+
+// parse the value of tag t
+func (h *Hessian) parse(t byte) (v interface{}, err error) {
+	var b []byte
 	switch t {
 	case 'r': // reply
-		h.next(2)
-		return h.Parse()
+		if _, err = h.next(2); err != nil {
+			return
+		}
+		return h.parseItem(t)
+
+	case 'H': // hessian 2.0 reply
+		if err = h.reply2(); err != nil {
+			return
+		}
+		return h.parseItem(t)
 
 	case 'f': // fault
-		h.Parse() // drop "code"
-		code, _ := h.Parse()
-		h.Parse() // drop "message"
-		message, _ := h.Parse()
-		v = nil
-		err = log.Errorf("%s : %s", code, message)
+		var fault [4]interface{} // "code", code, "message", message
+		for i := range fault {
+			if fault[i], err = h.parseItem(t); err != nil {
+				return
+			}
+		}
+		err = &Fault{Code: fmt.Sprint(fault[1]), Message: fmt.Sprint(fault[3])}
+
 	case 'N': // null
 		v = nil
 
@@ -108,45 +295,58 @@ func (h *Hessian) Parse() (v interface{}, err error) {
 	case 'F': // false
 		v = false
 
-	case 'I': // int
-		if v, err = UnpackInt32(h.next(4)); err != nil {
-			return nil, err
+	case 'I', 'R': // int, ref
+		var i int32
+		if b, err = h.next(4); err != nil {
+			return
 		}
-
-	case 'L': // long
-		if v, err = UnpackInt64(h.next(8)); err != nil {
-			v = nil
+		if i, err = UnpackInt32(b); err != nil {
 			return
 		}
+		v = i
+		if t == 'R' {
+			if i < 0 || int(i) >= len(h.refs) {
+				return nil, fmt.Errorf("invalid reference %d", i)
+			}
+			v = &h.refs[i]
+		}
 
-	case 'D': // double
-		if v, err = UnpackFloat64(h.next(8)); err != nil {
-			v = nil
+	case 'L', 'd': // long, date
+		var l int64
+		if b, err = h.next(8); err != nil {
 			return
 		}
+		if l, err = UnpackInt64(b); err != nil {
+			return
+		}
+		v = l
+		if t == 'd' {
+			v = time.Unix(l/1000, l%1000*10E5).In(h.location())
+		}
 
-	case 'd': // date
-		var ms int64
-		if ms, err = UnpackInt64(h.next(8)); err != nil {
-			v = nil
+	case 'D': // double
+		if b, err = h.next(8); err != nil {
 			return
 		}
-		v = time.Unix(ms/1000, ms%1000*10E5)
+		if v, err = UnpackFloat64(b); err != nil {
+			return nil, err
+		}
 
 	case 'S', 's', 'X', 'x': // string, xml
-		var strChunks []rune
-		var l int16
+		var strChunks, chunk []rune
+		var l int
 		for { // avoid recursive readings Chunks
-			if l, err = UnpackInt16(h.next(2)); err != nil {
-				strChunks = nil
+			if l, err = h.nextLength(); err != nil {
+				return
+			}
+			if chunk, err = h.nextRune(l); err != nil {
 				return
 			}
-			strChunks = append(strChunks, h.nextRune(int(l))...)
+			strChunks = append(strChunks, chunk...)
 			if t == 'S' || t == 'X' {
 				break
 			}
-			if t, err = h.readByte(); err != nil {
-				strChunks = nil
+			if t, err = h.nextChunk(t); err != nil {
 				return
 			}
 		}
@@ -154,74 +354,83 @@ func (h *Hessian) Parse() (v interface{}, err error) {
 
 	case 'B', 'b': // binary
 		var bChunks []byte // Equivalent to []uint8
-		var l int16
+		var l int
 		for { // avoid recursive readings Chunks
-			if l, err = UnpackInt16(h.next(2)); err != nil {
-				bChunks = nil
+			if l, err = h.nextLength(); err != nil {
 				return
 			}
-			bChunks = append(bChunks, h.next(int(l))...)
+			if b, err = h.next(l); err != nil {
+				return
+			}
+			bChunks = append(bChunks, b...)
 			if t == 'B' {
 				break
 			}
-			if t, err = h.readByte(); err != nil {
-				bChunks = nil
+			if t, err = h.nextChunk(t); err != nil {
 				return
 			}
 		}
 		v = bChunks
 
 	case 'V': // list
-		h.readType()
+		var typ string
 		var listChunks []interface{}
-		if h.peekByte() == 'l' {
-			h.next(5)
+		var next byte
+		if typ, err = h.readType(); err != nil {
+			return
 		}
-		for h.peekByte() != 'z' {
-			if _v, _e := h.Parse(); _e != nil {
-				listChunks = nil
-				return
-			} else {
-				listChunks = append(listChunks, _v)
+		if next, err = h.peekByte(); err == nil && next == 'l' {
+			_, err = h.next(5)
+		}
+		for err == nil {
+			if next, err = h.peekByte(); err != nil || next == 'z' {
+				break
+			}
+			var item interface{}
+			if item, err = h.parseItem(t); err == nil {
+				listChunks = append(listChunks, item)
 			}
 		}
-		h.readByte()
-		v = listChunks
+		if err != nil {
+			return
+		}
+		h.discard(1)
 		h.appendRefs(&listChunks)
+		return h.typedList(typ, listChunks)
 
 	case 'M': // map
-		h.readType()
+		var typ string
+		var next byte
+		if typ, err = h.readType(); err != nil {
+			return
+		}
 		var mapChunks = make(map[interface{}]interface{})
-		for h.peekByte() != 'z' {
-			_kv, _ke := h.Parse()
-			if _ke != nil {
-				mapChunks = nil
-				err = _ke
+		for {
+			if next, err = h.peekByte(); err != nil {
+				return
+			}
+			if next == 'z' {
+				break
+			}
+			var key, value interface{}
+			offset := h.offset
+			if key, err = h.parseItem(t); err != nil {
+				return
+			}
+			if key, err = mapKey(key, offset, t); err != nil {
 				return
 			}
-			_vv, _ve := h.Parse()
-			if _ve != nil {
-				mapChunks = nil
-				err = _ve
+			if value, err = h.parseItem(t); err != nil {
 				return
 			}
-			mapChunks[_kv] = _vv
+			mapChunks[key] = value
 		}
-		h.readByte()
-		v = mapChunks
+		h.discard(1)
 		h.appendRefs(&mapChunks)
-
-	case 'R': //ref
-		var refIdx int32
-		if refIdx, err = UnpackInt32(h.next(4)); err != nil {
-			return
-		}
-		if len(h.refs) > int(refIdx) {
-			v = &h.refs[refIdx]
-		}
+		return h.typedMap(typ, mapChunks)
 
 	default:
-		err = fmt.Errorf("Invalid type: %v,>>%v<<<", string(t), h.peek(h.len()))
+		err = &DecodeError{Offset: h.offset - 1, Tag: t, Err: errors.New("invalid tag")}
 	} // switch
 	return
 } // Parse end
@@ -0,0 +1,408 @@
+// Decode hessian 2.0 data
+package gohessian
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// class2 is a class definition of hessian 2.0 objects
+type class2 struct {
+	name   string
+	fields []string
+}
+
+// reply2 read the rest of a hessian 2.0 reply head 'H' x02 x00 and the tag
+// of its body, the following values are hessian 2.0. A fault is returned as
+// error.
+func (h *Hessian) reply2() error {
+	if _, err := h.next(2); err != nil {
+		return err
+	}
+	h.Hessian2 = true
+	t, err := h.readByte()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case 'R':
+		return nil
+	case 'F':
+		v, err := h.parseItem(t)
+		if err != nil {
+			return err
+		}
+		m, err := ToMap(v)
+		if err != nil {
+			return err
+		}
+		return &Fault{Code: fmt.Sprint(m["code"]), Message: fmt.Sprint(m["message"])}
+	}
+	return fmt.Errorf("invalid hessian 2.0 reply %q", t)
+}
+
+// parse2 parse the value of tag t in the hessian 2.0 grammar
+func (h *Hessian) parse2(t byte) (v interface{}, err error) {
+	var b []byte
+	switch {
+	case t == 'N':
+		return nil, nil
+	case t == 'T':
+		return true, nil
+	case t == 'F':
+		return false, nil
+
+	case t >= 0x80 && t <= 0xbf: // int
+		return int32(t) - 0x90, nil
+	case t >= 0xc0 && t <= 0xcf:
+		if b, err = h.next(1); err != nil {
+			return
+		}
+		return (int32(t)-0xc8)<<8 | int32(b[0]), nil
+	case t >= 0xd0 && t <= 0xd7:
+		if b, err = h.next(2); err != nil {
+			return
+		}
+		return (int32(t)-0xd4)<<16 | int32(b[0])<<8 | int32(b[1]), nil
+	case t == 'I':
+		if b, err = h.next(4); err != nil {
+			return
+		}
+		return UnpackInt32(b)
+
+	case t >= 0xd8 && t <= 0xef: // long
+		return int64(t) - 0xe0, nil
+	case t >= 0xf0:
+		if b, err = h.next(1); err != nil {
+			return
+		}
+		return (int64(t)-0xf8)<<8 | int64(b[0]), nil
+	case t >= 0x38 && t <= 0x3f:
+		if b, err = h.next(2); err != nil {
+			return
+		}
+		return (int64(t)-0x3c)<<16 | int64(b[0])<<8 | int64(b[1]), nil
+	case t == 0x59:
+		var i int32
+		if b, err = h.next(4); err == nil {
+			i, err = UnpackInt32(b)
+		}
+		return int64(i), err
+	case t == 'L':
+		if b, err = h.next(8); err != nil {
+			return
+		}
+		return UnpackInt64(b)
+
+	case t == 0x5b: // double
+		return 0.0, nil
+	case t == 0x5c:
+		return 1.0, nil
+	case t == 0x5d:
+		if b, err = h.next(1); err != nil {
+			return
+		}
+		return float64(int8(b[0])), nil
+	case t == 0x5e:
+		if b, err = h.next(2); err != nil {
+			return
+		}
+		return float64(int16(b[0])<<8 | int16(b[1])), nil
+	case t == 0x5f: // thousandths, as java writes them
+		var i int32
+		if b, err = h.next(4); err == nil {
+			i, err = UnpackInt32(b)
+		}
+		return 0.001 * float64(i), err
+	case t == 'D':
+		if b, err = h.next(8); err != nil {
+			return
+		}
+		return UnpackFloat64(b)
+
+	case t == 0x4a: // date
+		var ms int64
+		if b, err = h.next(8); err == nil {
+			ms, err = UnpackInt64(b)
+		}
+		return time.Unix(ms/1000, ms%1000*10e5).In(h.location()), err
+	case t == 0x4b:
+		var min int32
+		if b, err = h.next(4); err == nil {
+			min, err = UnpackInt32(b)
+		}
+		return time.Unix(int64(min)*60, 0).In(h.location()), err
+
+	case t <= 0x1f, t >= 0x30 && t <= 0x33, t == 'R', t == 'S':
+		return h.readString2(t)
+
+	case t >= 0x20 && t <= 0x2f, t >= 0x34 && t <= 0x37, t == 'A', t == 'B':
+		var data []byte
+		for final := false; !final; {
+			var l int
+			if l, final, err = h.binaryChunk(t); err != nil {
+				return
+			}
+			if b, err = h.next(l); err != nil {
+				return
+			}
+			data = append(data, b...)
+			if !final {
+				if t, err = h.readByte(); err != nil {
+					return
+				}
+			}
+		}
+		return data, nil
+
+	case t >= 0x70 && t <= 0x7f, t == 'V', t == 'X', t == 'U', t == 'W':
+		return h.parseList2(t)
+
+	case t == 'H', t == 'M':
+		var typ string
+		if t == 'M' {
+			if typ, err = h.readType2(); err != nil {
+				return
+			}
+		}
+		entries := make(map[interface{}]interface{})
+		h.appendRefs(&entries)
+		for {
+			var next byte
+			if next, err = h.peekByte(); err != nil {
+				return
+			}
+			if next == 'Z' {
+				break
+			}
+			var key, value interface{}
+			offset := h.offset
+			if key, err = h.parseItem(t); err != nil {
+				return
+			}
+			if key, err = mapKey(key, offset, t); err != nil {
+				return
+			}
+			if value, err = h.parseItem(t); err != nil {
+				return
+			}
+			entries[key] = value
+		}
+		h.discard(1)
+		return h.typedMap(typ, entries)
+
+	case t == 'C': // class definition, followed by a value
+		c := class2{}
+		if c.name, err = h.readString2Item(); err != nil {
+			return
+		}
+		var n int32
+		if n, err = h.readInt2(); err != nil {
+			return
+		}
+		for i := int32(0); i < n; i++ {
+			var f string
+			if f, err = h.readString2Item(); err != nil {
+				return
+			}
+			c.fields = append(c.fields, f)
+		}
+		h.classes = append(h.classes, c)
+		if t, err = h.readByte(); err != nil {
+			return
+		}
+		return h.parse2(t)
+
+	case t == 'O', t >= 0x60 && t <= 0x6f: // object
+		idx := int32(t) - 0x60
+		if t == 'O' {
+			if idx, err = h.readInt2(); err != nil {
+				return
+			}
+		}
+		if idx < 0 || int(idx) >= len(h.classes) {
+			return nil, fmt.Errorf("undefined class %d", idx)
+		}
+		c := h.classes[idx]
+		entries := make(map[interface{}]interface{}, len(c.fields))
+		h.appendRefs(&entries)
+		for _, f := range c.fields {
+			if entries[f], err = h.parseItem(t); err != nil {
+				return
+			}
+		}
+		return h.typedMap(c.name, entries)
+
+	case t == 'Q': // ref
+		var i int32
+		if i, err = h.readInt2(); err != nil {
+			return
+		}
+		if i < 0 || int(i) >= len(h.refs) {
+			return nil, fmt.Errorf("invalid reference %d", i)
+		}
+		return &h.refs[i], nil
+	}
+	return nil, &DecodeError{Offset: h.offset - 1, Tag: t, Err: errors.New("invalid tag")}
+}
+
+// parseList2 parse a hessian 2.0 list of tag t:
+//	x70-x77 type value*   typed list of length 0-7
+//	'V' type int value*   typed list
+//	x78-x7f value*        untyped list of length 0-7
+//	'X' int value*        untyped list
+//	'U' type value* 'Z'   typed list of variable length
+//	'W' value* 'Z'        untyped list of variable length
+func (h *Hessian) parseList2(t byte) (v interface{}, err error) {
+	var typ string
+	if t >= 0x70 && t <= 0x77 || t == 'V' || t == 'U' {
+		if typ, err = h.readType2(); err != nil {
+			return
+		}
+	}
+	n := -1 // until 'Z'
+	switch {
+	case t >= 0x70 && t <= 0x77:
+		n = int(t - 0x70)
+	case t >= 0x78 && t <= 0x7f:
+		n = int(t - 0x78)
+	case t == 'V', t == 'X':
+		var l int32
+		if l, err = h.readInt2(); err != nil {
+			return
+		}
+		if l < 0 {
+			return nil, fmt.Errorf("invalid list length %d", l)
+		}
+		n = int(l)
+	}
+	var items []interface{}
+	h.appendRefs(&items)
+	for i := 0; i != n; i++ {
+		if n < 0 {
+			var next byte
+			if next, err = h.peekByte(); err != nil {
+				return
+			}
+			if next == 'Z' {
+				h.discard(1)
+				break
+			}
+		}
+		var item interface{}
+		if item, err = h.parseItem(t); err != nil {
+			return
+		}
+		items = append(items, item)
+	}
+	return h.typedList(typ, items)
+}
+
+// readString2 read the chunks of a hessian 2.0 string starting with tag t
+func (h *Hessian) readString2(t byte) (string, error) {
+	var s []rune
+	for {
+		var l int
+		var err error
+		switch {
+		case t <= 0x1f:
+			l = int(t)
+		case t >= 0x30 && t <= 0x33:
+			var b []byte
+			if b, err = h.next(1); err != nil {
+				return "", err
+			}
+			l = int(t-0x30)<<8 | int(b[0])
+		case t == 'R', t == 'S':
+			if l, err = h.nextLength(); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("invalid string chunk %q", t)
+		}
+		chunk, err := h.nextRune(l)
+		if err != nil {
+			return "", err
+		}
+		s = append(s, chunk...)
+		if t != 'R' {
+			return string(s), nil
+		}
+		if t, err = h.readByte(); err != nil {
+			return "", err
+		}
+	}
+}
+
+// readString2Item read a hessian 2.0 string inside another value
+func (h *Hessian) readString2Item() (string, error) {
+	t, err := h.readByte()
+	if err != nil {
+		return "", err
+	}
+	return h.readString2(t)
+}
+
+// readInt2 read a hessian 2.0 int inside another value
+func (h *Hessian) readInt2() (int32, error) {
+	t, err := h.readByte()
+	if err != nil {
+		return 0, err
+	}
+	v, err := h.parse2(t)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := v.(int32)
+	if !ok {
+		return 0, fmt.Errorf("want int, got %T", v)
+	}
+	return i, nil
+}
+
+// readType2 read the type of a hessian 2.0 list or map, a string or the
+// index of a type read before
+func (h *Hessian) readType2() (string, error) {
+	t, err := h.peekByte()
+	if err != nil {
+		return "", err
+	}
+	if t <= 0x1f || t >= 0x30 && t <= 0x33 || t == 'R' || t == 'S' {
+		typ, err := h.readString2Item()
+		if err == nil {
+			h.types = append(h.types, typ)
+		}
+		return typ, err
+	}
+	i, err := h.readInt2()
+	if err != nil {
+		return "", err
+	}
+	if i < 0 || int(i) >= len(h.types) {
+		return "", fmt.Errorf("undefined type %d", i)
+	}
+	return h.types[i], nil
+}
+
+// binaryChunk read the length of a binary chunk of tag t, final tells
+// whether it is the last chunk
+func (h *Hessian) binaryChunk(t byte) (l int, final bool, err error) {
+	switch {
+	case t == 'B':
+		l, err = h.nextLength()
+		return l, true, err
+	case t == 'b' && !h.Hessian2, t == 'A' && h.Hessian2:
+		l, err = h.nextLength()
+		return l, false, err
+	case h.Hessian2 && t >= 0x20 && t <= 0x2f:
+		return int(t - 0x20), true, nil
+	case h.Hessian2 && t >= 0x34 && t <= 0x37:
+		b, err := h.next(1)
+		if err != nil {
+			return 0, false, err
+		}
+		return int(t-0x34)<<8 | int(b[0]), true, nil
+	}
+	return 0, false, fmt.Errorf("invalid binary chunk %q", t)
+}
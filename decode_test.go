@@ -2,10 +2,17 @@ package gohessian
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"math/big"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -266,3 +273,667 @@ func Test_parse_map(t *testing.T) {
 		t.Fatalf("error: %v", err)
 	}
 }
+
+type registeredOrder struct {
+	ID    int64 `hs:"id"`
+	Title string
+}
+
+type orderHolder struct {
+	Order  interface{}
+	Orders []registeredOrder
+}
+
+func Test_parse_registered_type(t *testing.T) {
+	registerTestType(t, "com.acme.RegisteredOrder", registeredOrder{})
+
+	order := registeredOrder{ID: 7, Title: "兔兔"}
+	b, err := Encode([]interface{}{order, map[string]interface{}{"order": order}})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !bytes.Contains(b, []byte("com.acme.RegisteredOrder")) {
+		t.Fatalf("registered name not encoded: %q", b)
+	}
+
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	list := v.([]interface{})
+	if list[0] != order {
+		t.Fatalf("want %+v, got %#v", order, list[0])
+	}
+	if m := list[1].(map[interface{}]interface{}); m["order"] != order {
+		t.Fatalf("want %+v, got %#v", order, m["order"])
+	}
+
+	var holder orderHolder
+	err = Bind(map[interface{}]interface{}{"Order": list[0], "Orders": list[:1]}, &holder)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if holder.Order != order || len(holder.Orders) != 1 || holder.Orders[0] != order {
+		t.Fatalf("unexpected holder %+v", holder)
+	}
+}
+
+func Test_parse_typed_values(t *testing.T) {
+	in := TypedList{Type: "[java.lang.StackTraceElement", Items: []interface{}{
+		TypedMap{Type: "java.lang.StackTraceElement", Entries: map[interface{}]interface{}{"lineNumber": int32(42)}},
+		TypedMap{Type: "java.util.HashMap", Entries: map[interface{}]interface{}{}},
+		[]interface{}{"untyped"},
+	}}
+	b, err := Encode(in)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, ok := v.([]interface{}); !ok {
+		t.Fatalf("want []interface {} without typed values, got %T", v)
+	}
+
+	h := NewHessian(bytes.NewReader(b))
+	h.TypedValues = true
+	if v, err = h.Parse(); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !reflect.DeepEqual(v, in) {
+		t.Fatalf("want %#v, got %#v", in, v)
+	}
+	again, err := Encode(v)
+	if err != nil || !bytes.Equal(b, again) {
+		t.Fatalf("want %v re-encoded, got %v, %v", b, again, err)
+	}
+
+	var frames []struct {
+		LineNumber int32 `hs:"lineNumber"`
+	}
+	if err = Bind(v, &frames); err != nil || len(frames) != 3 || frames[0].LineNumber != 42 {
+		t.Fatalf("unexpected frames %+v, %v", frames, err)
+	}
+}
+
+func Test_decode_node_round_trip(t *testing.T) {
+	b := []byte{'r', 1, 0,
+		'V', 't', 0, 4, 'l', 'i', 's', 't', 'l', 0, 0, 0, 6,
+		's', 0, 2, 'h', 'e', 'S', 0, 3, 'l', 'l', 'o', // chunked string
+		'b', 0, 1, 9, 'B', 0, 2, 8, 7, // chunked binary
+		'L', 0, 0, 0, 0, 0, 0, 0, 1, // small long
+		'M', 't', 0, 1, 'T', 'S', 0, 1, 'k', 'N', 'z', // null value
+		'R', 0, 0, 0, 0, // reference
+		'd', 0, 0, 1, 67, 206, 0, 226, 40,
+		'z', 'z'}
+
+	n, err := NewHessian(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	list := n.Items[0]
+	if list.Type != "list" || list.Length != 6 || len(list.Items) != 6 || len(list.Items[0].Chunks) != 2 {
+		t.Fatalf("unexpected list %+v", list)
+	}
+	if l := list.Items[2]; l.Tag != 'L' || l.Value != int64(1) {
+		t.Fatalf("want long 1, got %+v", l)
+	}
+	got, err := Encode(n)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	checkResult(b, got, t)
+
+	fault := []byte{'r', 1, 0, 'f',
+		'S', 0, 4, 'c', 'o', 'd', 'e', 'S', 0, 4, 'B', 'u', 's', 'y',
+		'S', 0, 7, 'm', 'e', 's', 's', 'a', 'g', 'e', 'S', 0, 2, 'n', 'o', 'z'}
+	if n, err = NewHessian(bytes.NewReader(fault)).Decode(); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if got, err = Encode(n); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	checkResult(fault, got, t)
+}
+
+type bigHolder struct {
+	Price  Decimal
+	Serial *big.Int
+	Rate   big.Float
+	Total  Decimal
+}
+
+func Test_parse_big_numbers(t *testing.T) {
+	serial, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	b, err := Encode(map[string]interface{}{
+		"Price":  Decimal("19.99"),
+		"Serial": serial,
+		"Rate":   big.NewFloat(0.125),
+		"Total": map[interface{}]interface{}{ // java serialized BigInteger
+			"signum": int32(1),
+			"mag":    []interface{}{int32(1), int32(-1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	for _, name := range []string{javaBigDecimal, javaBigInteger} {
+		if !bytes.Contains(b, []byte(name)) {
+			t.Fatalf("%s not encoded: %q", name, b)
+		}
+	}
+
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	m := v.(map[interface{}]interface{})
+	if m["Price"] != Decimal("19.99") {
+		t.Fatalf("want decimal 19.99, got %#v", m["Price"])
+	}
+	if i, ok := m["Serial"].(*big.Int); !ok || i.Cmp(serial) != 0 {
+		t.Fatalf("want %v, got %#v", serial, m["Serial"])
+	}
+
+	var holder bigHolder
+	if err = Bind(v, &holder); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if holder.Price != "19.99" || holder.Serial.Cmp(serial) != 0 ||
+		holder.Rate.Text('f', -1) != "0.125" || holder.Total != "8589934591" {
+		t.Fatalf("unexpected holder %+v", holder)
+	}
+
+	for _, d := range []Decimal{"12,5", "1/3", "0x1p3", "Inf", "1e", "", "."} {
+		if _, err = Encode(d); err == nil {
+			t.Fatalf("want error for invalid decimal %q", d)
+		}
+	}
+	for _, d := range []Decimal{"-12.50", "+1", "1.", ".5", "1E+3", "12.5e-2"} {
+		if _, err = Encode(d); err != nil {
+			t.Fatalf("error for decimal %q: %v", d, err)
+		}
+	}
+}
+
+type orderStatus string
+
+const (
+	statusActive  orderStatus = "ACTIVE"
+	statusDeleted orderStatus = "DELETED"
+)
+
+type level int32
+
+func (l level) String() string {
+	return [...]string{"LOW", "HIGH"}[l]
+}
+
+type statusHolder struct {
+	Status orderStatus
+	Level  level
+	Named  orderStatus
+}
+
+func Test_parse_enum(t *testing.T) {
+	RegisterEnum("com.acme.Status", statusActive, statusDeleted)
+	RegisterEnum("com.acme.Level", level(0), level(1))
+
+	b, err := Encode(map[string]interface{}{"Status": statusDeleted, "Level": level(1), "Named": "ACTIVE"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !bytes.Contains(b, []byte("com.acme.Status")) || !bytes.Contains(b, []byte("HIGH")) {
+		t.Fatalf("enum not encoded: %q", b)
+	}
+
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	m := v.(map[interface{}]interface{})
+	if m["Status"] != statusDeleted || m["Level"] != level(1) {
+		t.Fatalf("unexpected enums %#v", m)
+	}
+
+	var holder statusHolder
+	if err = Bind(v, &holder); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if holder != (statusHolder{statusDeleted, level(1), statusActive}) {
+		t.Fatalf("unexpected holder %+v", holder)
+	}
+
+	if _, err = Encode(orderStatus("PENDING")); err == nil {
+		t.Fatalf("want error for unknown constant")
+	}
+	b, _ = encodeClassString("com.acme.Status", "name", "PENDING")
+	if _, err = NewHessian(bytes.NewReader(b)).Parse(); err == nil {
+		t.Fatalf("want error for unknown name")
+	}
+}
+
+func Test_parse_java_time(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	at := time.Date(2024, 2, 29, 13, 4, 5, 6000000, time.UTC)
+
+	d := LocalDateOf(at)
+	dt := LocalDateTimeOf(at)
+	instant := TypedMap{Type: "java.time.Instant", Entries: map[interface{}]interface{}{"seconds": at.Unix(), "nanos": int32(7)}}
+	zoned := TypedMap{Type: java8Handle + "ZonedDateTimeHandle", Entries: map[interface{}]interface{}{
+		"dateTime": dt,
+		"offset":   TypedMap{Type: java8Handle + "ZoneOffsetHandle", Entries: map[interface{}]interface{}{"seconds": int32(3600)}},
+	}}
+	b, err := Encode([]interface{}{at, d, dt, instant, zoned})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !bytes.Contains(b, []byte(java8Handle+"LocalDateTimeHandle")) {
+		t.Fatalf("handle not encoded: %q", b)
+	}
+
+	h := NewHessian(bytes.NewReader(b))
+	h.Location = tokyo
+	v, err := h.Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	list := v.([]interface{})
+	if got := list[0].(time.Time); !got.Equal(at) || got.Location() != tokyo {
+		t.Fatalf("want %v in JST, got %v", at, got)
+	}
+	if list[1] != d || list[2] != dt || dt.String() != "2024-02-29T13:04:05.006" {
+		t.Fatalf("unexpected civil values %v %v", list[1], list[2])
+	}
+	if got := list[3].(time.Time); got.Location() != tokyo || !got.Equal(at.Truncate(time.Second).Add(7)) {
+		t.Fatalf("unexpected instant %v", got)
+	}
+	if got := list[4].(time.Time); got.Format(time.RFC3339) != "2024-02-29T13:04:05+01:00" {
+		t.Fatalf("unexpected zoned time %v", got)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetStrict(true)
+	if e.WriteTime(at.Add(1)); e.Err() == nil {
+		t.Fatalf("want error for sub-millisecond time")
+	}
+}
+
+func Test_parse_chunk_boundaries(t *testing.T) {
+	emoji := "😀" // two utf-16 code units
+	for _, c := range []struct {
+		s      string
+		chunks []int // utf-16 length of each chunk
+	}{
+		{strings.Repeat("a", CHUNK_SIZE-1), []int{CHUNK_SIZE - 1}},
+		{strings.Repeat("a", CHUNK_SIZE), []int{CHUNK_SIZE}},
+		{strings.Repeat("a", CHUNK_SIZE+1), []int{CHUNK_SIZE, 1}},
+		{strings.Repeat("a", CHUNK_SIZE-1) + emoji, []int{CHUNK_SIZE - 1, 2}},
+		{strings.Repeat("a", CHUNK_SIZE-2) + emoji, []int{CHUNK_SIZE}},
+		{strings.Repeat(emoji, CHUNK_SIZE), []int{CHUNK_SIZE, CHUNK_SIZE}},
+		{"兔" + strings.Repeat(emoji, CHUNK_SIZE/2), []int{CHUNK_SIZE - 1, 2}},
+	} {
+		b, err := Encode(c.s)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		n, err := NewHessian(bytes.NewReader(b)).Decode()
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		if len(n.Chunks) != len(c.chunks) {
+			t.Fatalf("want %d chunks, got %d", len(c.chunks), len(n.Chunks))
+		}
+		for i, chunk := range n.Chunks {
+			if int(chunk.Length) != c.chunks[i] {
+				t.Fatalf("chunk %d: want length %d, got %d", i, c.chunks[i], chunk.Length)
+			}
+		}
+		v, err := NewHessian(bytes.NewReader(b)).Parse()
+		if err != nil || v != c.s {
+			t.Fatalf("string of %d bytes not decoded, %v", len(c.s), err)
+		}
+	}
+
+	for _, size := range []int{0, 1, CHUNK_SIZE - 1, CHUNK_SIZE, CHUNK_SIZE + 1, 64 * CHUNK_SIZE} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		b, err := Encode(data)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		v, err := NewHessian(bytes.NewReader(b)).Parse()
+		if err != nil || !bytes.Equal(v.([]byte), data) {
+			t.Fatalf("binary of %d bytes not decoded, %v", size, err)
+		}
+	}
+}
+
+func Test_parse_supplementary_characters(t *testing.T) {
+	s := "a😀兔"
+	b, err := Encode(s)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	cesu := []byte{'S', 0, 4, 'a', 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0xe5, 0x85, 0x94}
+	checkResult(cesu, b, t)
+
+	// java writes surrogate pairs, other encoders may write utf-8
+	utf8Form := append([]byte{'S', 0, 4}, s...)
+	for _, in := range [][]byte{cesu, utf8Form} {
+		v, err := NewHessian(bytes.NewReader(in)).Parse()
+		if err != nil || v != s {
+			t.Fatalf("want %q, got %q, %v", s, v, err)
+		}
+		n, err := NewHessian(bytes.NewReader(in)).Decode()
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		got, err := n.MarshalHessian()
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		checkResult(in, got, t)
+	}
+
+	v, err := NewHessian(bytes.NewReader([]byte{'S', 0, 2, 0xed, 0xa0, 0xbd, 'b'})).Parse()
+	if err != nil || v != "�b" {
+		t.Fatalf("want unpaired surrogate replaced, got %q, %v", v, err)
+	}
+}
+
+// reply return a reply of a value which uses every kind of tag
+func testReply(t *testing.T) []byte {
+	v := TypedMap{Type: "com.acme.Order", Entries: map[interface{}]interface{}{
+		"name":  "a😀",
+		"data":  []byte("0123456789"),
+		"items": []interface{}{int32(1), int64(2), 1.5, nil, true},
+		"at":    time.Unix(1500000000, 0),
+	}}
+	b, err := Encode(v)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	return append(append([]byte{'r', 1, 0}, b...), 'z')
+}
+
+func Test_parse_truncated(t *testing.T) {
+	b := testReply(t)
+	if _, err := NewHessian(bytes.NewReader(nil)).Parse(); err != io.EOF {
+		t.Fatalf("want io.EOF for no data, got %v", err)
+	}
+	for i := 1; i < len(b)-1; i++ { // the final 'z' of the reply is optional
+		_, err := NewHessian(bytes.NewReader(b[:i])).Parse()
+		var de *DecodeError
+		if !errors.As(err, &de) || !errors.Is(err, io.ErrUnexpectedEOF) || de.Offset > int64(i) {
+			t.Fatalf("parse %d of %d bytes: want unexpected EOF, got %#v", i, len(b), err)
+		}
+		_, err = NewHessian(bytes.NewReader(b[:i])).Decode()
+		if !errors.As(err, &de) || !errors.Is(err, io.ErrUnexpectedEOF) || de.Offset > int64(i) {
+			t.Fatalf("decode %d of %d bytes: want unexpected EOF, got %#v", i, len(b), err)
+		}
+	}
+
+	_, err := NewHessian(bytes.NewReader([]byte{'I', 0, 0})).Parse()
+	want := &DecodeError{Offset: 3, Tag: 'I', Err: io.ErrUnexpectedEOF}
+	if !reflect.DeepEqual(err, want) {
+		t.Fatalf("want %v, got %v", want, err)
+	}
+	_, err = NewHessian(bytes.NewReader([]byte{'V', 'Q'})).Parse()
+	if de, ok := err.(*DecodeError); !ok || de.Tag != 'Q' || de.Offset != 1 {
+		t.Fatalf("want invalid tag Q at 1, got %v", err)
+	}
+	_, err = NewHessian(bytes.NewReader([]byte{'s', 0, 1, 'a', 'B', 0, 1, 'b'})).Parse()
+	if _, ok := err.(*DecodeError); !ok {
+		t.Fatalf("want invalid chunk, got %v", err)
+	}
+
+	boom := errors.New("boom")
+	r := io.MultiReader(bytes.NewReader(b[:10]), iotest.ErrReader(boom))
+	if _, err = NewHessian(r).Parse(); !errors.Is(err, boom) {
+		t.Fatalf("want read error, got %v", err)
+	}
+
+	_, err = ioutil.ReadAll(mustBinaryReader(t, []byte{'r', 1, 0, 'b', 0, 2, 'a', 'b', 'B', 0, 10, 'c'}))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("want unexpected EOF, got %v", err)
+	}
+}
+
+func Test_parse_slow_reader(t *testing.T) {
+	b := testReply(t)
+	want, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	for _, r := range []io.Reader{iotest.OneByteReader(bytes.NewReader(b)), iotest.HalfReader(bytes.NewReader(b))} {
+		v, err := NewHessian(r).Parse()
+		if err != nil || !reflect.DeepEqual(v, want) {
+			t.Fatalf("want %v, got %v, %v", want, v, err)
+		}
+	}
+	n, err := NewHessian(iotest.OneByteReader(bytes.NewReader(b))).Decode()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	got, err := n.MarshalHessian()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	checkResult(b, got, t)
+
+	data := bytes.Repeat([]byte("0123456789"), 7000)
+	enc, err := Encode(data)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	got, err = ioutil.ReadAll(mustBinaryReader(t, iotest.OneByteReader(bytes.NewReader(enc))))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("want %d bytes, got %d, %v", len(data), len(got), err)
+	}
+}
+
+// registerTestType register the type of v for the test only
+func registerTestType(t *testing.T, name string, v interface{}) {
+	RegisterType(name, v)
+	t.Cleanup(func() { unregisterType(name) })
+}
+
+// registerTestListType register the list type of elem for the test only
+func registerTestListType(t *testing.T, name string, elem interface{}) {
+	RegisterListType(name, elem)
+	t.Cleanup(func() { unregisterListType(name) })
+}
+
+func mustBinaryReader(t *testing.T, in interface{}) io.Reader {
+	r, ok := in.(io.Reader)
+	if !ok {
+		r = bytes.NewReader(in.([]byte))
+	}
+	br, err := NewHessian(r).BinaryReader()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	return br
+}
+
+func Test_parse_hessian2_round_trip(t *testing.T) {
+	bin := make([]byte, 2*CHUNK_SIZE+10)
+	for i := range bin {
+		bin[i] = byte(i)
+	}
+	in := []interface{}{
+		nil, true, false,
+		int32(0), int32(-16), int32(47), int32(-2048), int32(2047), int32(-262144), int32(262143), int32(-1 << 31),
+		int64(-8), int64(15), int64(-2048), int64(2047), int64(-262144), int64(262143), int64(1 << 30), int64(1 << 40),
+		0.0, 1.0, -128.0, 127.0, -32768.0, 32767.0, 12.25, -0.5, math.Pi,
+		time.Unix(1700000040, 0), time.Unix(1700000000, 5e8),
+		"", "short", strings.Repeat("a", 500), strings.Repeat("é€😀", CHUNK_SIZE/2),
+		[]byte{}, bin[:10], bin[:1000], bin,
+		[]interface{}{int32(1), "two"},
+		make([]interface{}, 9),
+		TypedList{Type: "java.util.ArrayList", Items: []interface{}{int32(1)}},
+		TypedList{Type: "java.util.ArrayList", Items: make([]interface{}, 8)},
+		map[interface{}]interface{}{"a": int32(1), int32(2): []interface{}{"b"}},
+		TypedMap{Type: "com.acme.Point", Entries: map[interface{}]interface{}{"x": int32(1), "y": 2.5}},
+	}
+	b1, err := Encode(in)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	h := NewHessian(bytes.NewReader(b1))
+	h.TypedValues = true
+	want, err := h.Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetHessian2(true)
+	e.Encode(in)
+	if e.Err() != nil {
+		t.Fatalf("error: %v", e.Err())
+	}
+	if b := buf.Bytes(); b[0] != 'X' || bytes.Contains(b, []byte("java.util.ArrayList\x00")) {
+		t.Fatalf("want a hessian 2.0 list, got %q...", b[:16])
+	}
+	h = NewHessian(&buf)
+	h.TypedValues = true
+	h.Hessian2 = true
+	got, err := h.Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if _, err = h.Parse(); err != io.EOF {
+		t.Fatalf("want io.EOF, got %v", err)
+	}
+}
+
+func Test_parse_hessian2_java(t *testing.T) {
+	// a reply written by java Hessian2Output
+	b := []byte{'H', 2, 0, 'R', 'W'}
+	b = append(b, 'C', 0x0b)
+	b = append(b, "com.acme.Pt"...)
+	b = append(b, 0x92, 0x01, 'x', 0x01, 'y') // class 0
+	b = append(b, 0x60, 0x91, 0x92)           // Pt{1, 2}
+	b = append(b, 'O', 0x90, 0x93, 0x94)      // Pt{3, 4}
+	b = append(b, 'U', 0x13)
+	b = append(b, "java.util.ArrayList"...)
+	b = append(b, 0x91, 'Z')
+	b = append(b, 0x71, 0x90, 0x92)            // type 0, length 1
+	b = append(b, 'V', 0x90, 0x92, 0x93, 0x94) // type 0, length 2
+	b = append(b, 'H', 0x01, 'k', 0x35, 0x01)
+	b = append(b, make([]byte, 0x101)...)
+	b = append(b, 'Z')
+	b = append(b, 'Q', 0x91)                    // Pt{1, 2}
+	b = append(b, 0x4b, 0x01, 0x02, 0x03, 0x04) // minutes
+	b = append(b, 0x5f, 0xff, 0xff, 0xff, 0xfe) // -0.002
+	b = append(b, 0x3b, 0x00, 0x00)             // long -65536
+	b = append(b, 'Z')
+
+	h := NewHessian(bytes.NewReader(b))
+	h.TypedValues = true
+	h.Location = time.UTC
+	v, err := h.Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !h.Hessian2 {
+		t.Fatalf("want hessian 2.0 set by the reply")
+	}
+	pt := func(x, y int32) TypedMap {
+		return TypedMap{Type: "com.acme.Pt", Entries: map[interface{}]interface{}{"x": x, "y": y}}
+	}
+	list := func(items ...interface{}) TypedList {
+		return TypedList{Type: "java.util.ArrayList", Items: items}
+	}
+	got, ok := v.([]interface{})
+	if !ok || len(got) != 10 {
+		t.Fatalf("unexpected reply %#v", v)
+	}
+	ref, ok := got[6].(*Any)
+	if !ok {
+		t.Fatalf("want a reference, got %#v", got[6])
+	}
+	if m, ok := (*ref).(*map[interface{}]interface{}); !ok || (*m)["y"] != int32(2) {
+		t.Fatalf("want a reference to Pt{1, 2}, got %#v", *ref)
+	}
+	want := []interface{}{
+		pt(1, 2), pt(3, 4), list(int32(1)), list(int32(2)), list(int32(3), int32(4)),
+		map[interface{}]interface{}{"k": make([]byte, 0x101)}, got[6],
+		time.Unix(0x01020304*60, 0).In(time.UTC), -0.002, int64(-65536),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %#v, got %#v", want, got)
+	}
+
+	fault := []byte{'H', 2, 0, 'F', 'H', 0x04, 'c', 'o', 'd', 'e', 0x10}
+	fault = append(fault, "ServiceException"...)
+	fault = append(fault, 0x07)
+	fault = append(fault, "message"...)
+	fault = append(fault, 0x04, 'o', 'o', 'p', 's', 'Z')
+	_, err = NewHessian(bytes.NewReader(fault)).Parse()
+	if f, ok := err.(*Fault); !ok || f.Code != "ServiceException" || f.Message != "oops" {
+		t.Fatalf("want fault, got %#v", err)
+	}
+
+	if _, err = NewHessian(bytes.NewReader(b)).Decode(); err == nil {
+		t.Fatalf("want an error decoding hessian 2.0 as Node")
+	}
+}
+
+func Test_parse_invalid_map_keys_and_refs(t *testing.T) {
+	for _, hessian2 := range []bool{false, true} {
+		tests := []struct {
+			in     []byte
+			offset int64
+			tag    byte
+		}{
+			{[]byte{'M', 'V', 'z', 'T', 'z'}, 1, 'M'},
+			{[]byte{'M', 'N', 'T', 'M', 'z', 'T', 'z'}, 3, 'M'},
+			{[]byte{'M', 'V', 't', 0, 1, 'x', 'z', 'T', 'z'}, 1, 'M'}, // TypedList
+			{[]byte{'R', 0, 0, 0, 0}, 5, 'R'},
+			{[]byte{'R', 0xff, 0xff, 0xff, 0xff}, 5, 'R'},
+		}
+		binKey := []byte{'M', 'B', 0, 1, 'k', 'T', 'z'}
+		if hessian2 {
+			tests = []struct {
+				in     []byte
+				offset int64
+				tag    byte
+			}{
+				{[]byte{'H', 0x78, 'T', 'Z'}, 1, 'H'},
+				{[]byte{'H', 'N', 'T', 'H', 'Z', 'T', 'Z'}, 3, 'H'},
+				{[]byte{'H', 0x70, 0x01, 'x', 'T', 'Z'}, 1, 'H'}, // TypedList
+				{[]byte{'Q', 0x90}, 2, 'Q'},
+				{[]byte{'Q', 0x8f}, 2, 'Q'},
+			}
+			binKey = []byte{'H', 0x21, 'k', 'T', 'Z'}
+		}
+		for _, test := range tests {
+			h := NewHessian(bytes.NewReader(test.in))
+			h.TypedValues = true
+			h.Hessian2 = hessian2
+			v, err := h.Parse()
+			de, ok := err.(*DecodeError)
+			if !ok || de.Offset != test.offset || de.Tag != test.tag {
+				t.Fatalf("%q: want decode error of %q at %d, got %#v, %v", test.in, test.tag, test.offset, v, err)
+			}
+		}
+		h := NewHessian(bytes.NewReader(binKey))
+		h.Hessian2 = hessian2
+		v, err := h.Parse()
+		if m, ok := v.(map[interface{}]interface{}); err != nil || !ok || m["k"] != true {
+			t.Fatalf("want binary key as string, got %#v, %v", v, err)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 // Encode values of types to hessian protocol 2.0:
-//	- int, int32, int64
-//	- float64
+//	- numbers of every kind, see Encode
 //	- bool
+//	- *big.Int, *big.Float and Decimal, as java.math.BigInteger and BigDecimal
 //	- time.Time
 //	- []byte
 //	- slice
@@ -14,24 +14,50 @@ package gohessian
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf16"
 	"unicode/utf8"
 
 	log "github.com/cihub/seelog"
 )
 
+// Encoder write hessian encoded values to an output stream, the first
+// error is kept and returned by Err and by every later Encode
 type Encoder struct {
+	w    io.Writer
+	err  error
+	opts encodeOptions
+}
+
+// encodeOptions change how values are encoded, the zero value is the
+// encoding of Encode
+type encodeOptions struct {
+	strict        bool // error on lossy conversions
+	hessian2      bool // hessian 2.0 grammar, see marshal
+	deterministic bool // sorted map keys
 }
 
 type HessianName struct{}
 
+var (
+	marshalerType = reflect.TypeOf((*HessianMarshaler)(nil)).Elem()
+	writerType    = reflect.TypeOf((*HessianWriter)(nil)).Elem()
+)
+
 const (
 	CHUNK_SIZE    = 0x8000
 	ENCODER_DEBUG = false
 	hessianTag    = "hs"
 	nameTypeName  = "HessianName"
 	fieldName     = "Name"
+	javaHashSet   = "java.util.HashSet"
 )
 
 //func init() {
@@ -42,7 +68,63 @@ const (
 //}
 
 // Encode do encode var to binary under hessian protocol
+//
+// Numbers are encoded by their kind, also for named types like
+// type UserID int64:
+//	- int8, int16, int32, uint8, uint16 as int
+//	- int and uint as int, or as long when out of the int range
+//	- int64, uint32, uint64 and uintptr as long, uint64 above the long range
+//	  wraps to negative like a java long holding it, see Encoder.SetStrict
+//	- float32 and float64 as double
 func Encode(v interface{}) (b []byte, err error) {
+	return encodeOptions{}.encode(v)
+}
+
+// marshal encode v as a whole value of a message. In hessian 2.0 the value
+// is encoded in 1.0 and transcoded, so that the bytes of marshalers nested
+// in it are transcoded too.
+func (o encodeOptions) marshal(v interface{}) ([]byte, error) {
+	if !o.hessian2 {
+		return o.encode(v)
+	}
+	o.hessian2 = false
+	return hessian2(o.encode(v))
+}
+
+// put write the hessian 1.0 encoding b of a whole value, in the grammar of
+// the encoder
+func (e *Encoder) put(b []byte, err error) {
+	if e.opts.hessian2 {
+		b, err = hessian2(b, err)
+	}
+	e.write(b, err)
+}
+
+// isMarshaler tell whether t is a HessianWriter or a HessianMarshaler
+func isMarshaler(t reflect.Type) bool {
+	return t.Implements(writerType) || t.Implements(marshalerType)
+}
+
+// encodeMarshaler encode v which encode itself, a HessianWriter is given an
+// encoder with the options o
+func (o encodeOptions) encodeMarshaler(v interface{}) ([]byte, error) {
+	if w, ok := v.(HessianWriter); ok {
+		var b bytes.Buffer
+		o.hessian2 = false // transcoded with the whole value, see marshal
+		e := &Encoder{w: &b, opts: o}
+		if err := w.WriteHessian(e); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), e.Err()
+	}
+	return v.(HessianMarshaler).MarshalHessian()
+}
+
+// encode encode v with the options o
+func (o encodeOptions) encode(v interface{}) (b []byte, err error) {
+	if v == nil {
+		return encodeNull(v)
+	}
 	t := reflect.TypeOf(v)
 
 	// dereference any pointer
@@ -50,7 +132,39 @@ func Encode(v interface{}) (b []byte, err error) {
 		if reflect.ValueOf(v).IsNil() {
 			return encodeNull(v)
 		}
+		if isMarshaler(t) {
+			return o.encodeMarshaler(v)
+		}
+		if r, ok := v.(io.Reader); ok {
+			return encodeReader(r)
+		}
 		v = reflect.ValueOf(v).Elem().Interface()
+		t = reflect.TypeOf(v)
+	}
+
+	// typed values keep the options for their content
+	switch tv := v.(type) {
+	case TypedMap:
+		return o.encodeTypedMap(tv.Type, tv.entries())
+	case TypedList:
+		return o.encodeTypedList(tv.Type, tv.Items)
+	}
+
+	// custom encoding, also for values of types marshaled by pointer
+	if isMarshaler(t) {
+		return o.encodeMarshaler(v)
+	}
+	if isMarshaler(reflect.PtrTo(t)) {
+		p := reflect.New(t)
+		p.Elem().Set(reflect.ValueOf(v))
+		return o.encodeMarshaler(p.Interface())
+	}
+	if r, ok := v.(io.Reader); ok {
+		return encodeReader(r)
+	}
+
+	if en, ok := lookupEnum(t); ok {
+		return en.encode(v)
 	}
 
 	// basic types
@@ -58,45 +172,74 @@ func Encode(v interface{}) (b []byte, err error) {
 	case []byte:
 		b, err = encodeBinary(v.([]byte))
 
-	case bool:
-		b, err = encodeBool(v.(bool))
-
 	case time.Time:
-		b, err = encodeTime(v.(time.Time))
+		b, err = o.encodeTime(v.(time.Time))
 
-	case float64:
-		b, err = encodeFloat64(v.(float64))
+	case big.Int:
+		x := v.(big.Int)
+		b, err = encodeBigInt(&x)
 
-	case int:
-		if v.(int) >= -2147483648 && v.(int) <= 2147483647 {
-			b, err = encodeInt32(int32(v.(int)))
-		} else {
-			b, err = encodeInt64(int64(v.(int)))
-		}
+	case big.Float:
+		x := v.(big.Float)
+		b, err = encodeBigFloat(&x)
 
-	case int32:
-		b, err = encodeInt32(v.(int32))
+	default:
+		rv := reflect.ValueOf(v)
+		switch t.Kind() {
+		case reflect.Bool:
+			b, err = encodeBool(rv.Bool())
+
+		case reflect.Int8, reflect.Int16, reflect.Int32:
+			b, err = encodeInt32(int32(rv.Int()))
+
+		case reflect.Int:
+			if rv.Int() >= math.MinInt32 && rv.Int() <= math.MaxInt32 {
+				b, err = encodeInt32(int32(rv.Int()))
+			} else {
+				b, err = encodeInt64(rv.Int())
+			}
 
-	case int64:
-		b, err = encodeInt64(v.(int64))
+		case reflect.Int64:
+			b, err = encodeInt64(rv.Int())
 
-	case string:
-		b, err = encodeString(v.(string))
-	}
+		case reflect.Uint8, reflect.Uint16:
+			b, err = encodeInt32(int32(rv.Uint()))
 
-	// reference types
-	switch t.Kind() {
-	case reflect.Slice, reflect.Array:
-		b, err = encodeList(v)
+		case reflect.Uint:
+			if rv.Uint() <= math.MaxInt32 {
+				b, err = encodeInt32(int32(rv.Uint()))
+			} else {
+				b, err = o.encodeUint64(rv.Uint())
+			}
 
-	case reflect.Struct:
-		b, err = encodeStruct(v)
+		case reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			b, err = o.encodeUint64(rv.Uint())
 
-	case reflect.Map:
-		b, err = encodeMap(v)
+		case reflect.Float32, reflect.Float64:
+			b, err = encodeFloat64(rv.Float())
 
-	default:
-		return nil, errors.New("unkown kind")
+		case reflect.String:
+			b, err = encodeString(rv.String())
+
+		// reference types
+		case reflect.Slice, reflect.Array:
+			name, _ := registeredListName(t.Elem())
+			b, err = o.encodeTypedList(name, v)
+
+		case reflect.Struct:
+			b, err = o.encodeStruct(v)
+
+		case reflect.Map:
+			if isSet(t) {
+				b, err = o.encodeSet(javaHashSet, v)
+			} else {
+				name, _ := registeredName(t)
+				b, err = o.encodeTypedMap(name, v)
+			}
+
+		default:
+			return nil, fmt.Errorf("unkown kind %v of %v", t.Kind(), t)
+		}
 	}
 
 	if ENCODER_DEBUG {
@@ -105,6 +248,148 @@ func Encode(v interface{}) (b []byte, err error) {
 	return
 }
 
+// NewEncoder return an encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Err return the first error of the encoder
+func (e *Encoder) Err() error {
+	return e.err
+}
+
+// write write b to the output stream unless an error occurred
+func (e *Encoder) write(b []byte, err error) {
+	if e.err != nil {
+		return
+	}
+	if err != nil {
+		e.err = err
+		return
+	}
+	_, e.err = e.w.Write(b)
+}
+
+// SetStrict make the encoder fail on lossy conversions instead, like an
+// uint64 above the long range or a time with sub-millisecond precision
+func (e *Encoder) SetStrict(on bool) {
+	e.opts.strict = on
+}
+
+// SetHessian2 make the encoder write values in the hessian 2.0 grammar, with
+// compact numbers, strings and fixed length lists and maps ended by 'Z', for
+// servers reading hessian 2.0. The bytes of marshalers are transcoded.
+func (e *Encoder) SetHessian2(on bool) {
+	e.opts.hessian2 = on
+}
+
+// SetDeterministic make the encoder write the entries of maps and sets
+// sorted by the encoding of their keys, so that equal values are encoded as
+// the same bytes, for signing or hashing requests
+func (e *Encoder) SetDeterministic(on bool) {
+	e.opts.deterministic = on
+}
+
+// Encode write the encoding of v, an io.Reader is streamed as binary by
+// WriteBinaryFrom, inside other values it is read into memory
+func (e *Encoder) Encode(v interface{}) error {
+	if r, ok := streamedReader(v); ok && e.err == nil {
+		e.WriteBinaryFrom(r)
+		return e.err
+	}
+	e.write(e.opts.marshal(v))
+	return e.err
+}
+
+// WriteNull write null
+func (e *Encoder) WriteNull() {
+	e.put(encodeNull(nil))
+}
+
+// WriteBool write boolean
+func (e *Encoder) WriteBool(v bool) {
+	e.put(encodeBool(v))
+}
+
+// WriteInt32 write int
+func (e *Encoder) WriteInt32(v int32) {
+	e.put(encodeInt32(v))
+}
+
+// WriteInt64 write long
+func (e *Encoder) WriteInt64(v int64) {
+	e.put(encodeInt64(v))
+}
+
+// WriteFloat64 write double
+func (e *Encoder) WriteFloat64(v float64) {
+	e.put(encodeFloat64(v))
+}
+
+// WriteString write string
+func (e *Encoder) WriteString(v string) {
+	e.put(encodeString(v))
+}
+
+// WriteTime write date
+func (e *Encoder) WriteTime(v time.Time) {
+	e.put(e.opts.encodeTime(v))
+}
+
+// WriteBinary write binary
+func (e *Encoder) WriteBinary(v []byte) {
+	e.put(encodeBinary(v))
+}
+
+// WriteMapBegin write the head of a map of type name, the entries follow
+// as keys and values, an empty name writes an untyped map
+func (e *Encoder) WriteMapBegin(name string) {
+	if !e.opts.hessian2 {
+		e.write(encodeMapHead(name))
+		return
+	}
+	if name == "" {
+		e.write([]byte{'H'}, nil)
+		return
+	}
+	tmp, err := encodeString2(name)
+	e.write(append([]byte{'M'}, tmp...), err)
+}
+
+// WriteMapEnd write the end of a map
+func (e *Encoder) WriteMapEnd() {
+	if e.opts.hessian2 {
+		e.write([]byte{'Z'}, nil)
+		return
+	}
+	e.write([]byte{'z'}, nil)
+}
+
+// WriteField write a map entry of key and v following the comma separated
+// options of a hs tag, like "omitempty,long", as for a struct field.
+// hessiangen -marshal uses it for fields with tag options.
+func (e *Encoder) WriteField(key string, v interface{}, options string) {
+	if e.err != nil {
+		return
+	}
+	f := field{name: key, goName: key, typ: reflect.TypeOf(v)}
+	if options != "" {
+		if e.err = f.parseOptions(strings.Split(options, ",")); e.err != nil {
+			return
+		}
+	}
+	rv := reflect.ValueOf(v)
+	if f.omitEmpty && (!rv.IsValid() || isEmptyValue(rv)) {
+		return
+	}
+	e.WriteString(key)
+	if !rv.IsValid() {
+		e.WriteNull()
+		return
+	}
+	e.put(e.opts.encodeField(f, rv))
+}
+
 // encodeBinary binary
 func encodeBinary(v []byte) (b []byte, err error) {
 	var (
@@ -158,11 +443,11 @@ func encodeBool(v bool) (b []byte, err error) {
 	return
 }
 
-// encodeTime encode date
+// encodeTime encode date, as milliseconds since the epoch rounded down
 func encodeTime(v time.Time) (b []byte, err error) {
 	var tmpV []byte
 	b = append(b, 'd')
-	if tmpV, err = PackInt64(v.UnixNano() / 1000000); err != nil {
+	if tmpV, err = PackInt64(v.UnixMilli()); err != nil {
 		b = nil
 		return
 	}
@@ -170,6 +455,18 @@ func encodeTime(v time.Time) (b []byte, err error) {
 	return
 }
 
+// encodeTime encode date, which has milliseconds precision, finer times and
+// times out of the range of a long of milliseconds fail when strict
+func (o encodeOptions) encodeTime(v time.Time) ([]byte, error) {
+	if o.strict && v.Nanosecond()%int(time.Millisecond) != 0 {
+		return nil, fmt.Errorf("%v has sub-millisecond precision", v)
+	}
+	if o.strict && !time.UnixMilli(v.UnixMilli()).Equal(v.Truncate(time.Millisecond)) {
+		return nil, fmt.Errorf("%v overflows a date", v)
+	}
+	return encodeTime(v)
+}
+
 // encodeFloat64 encode double
 func encodeFloat64(v float64) (b []byte, err error) {
 	var tmpV []byte
@@ -207,118 +504,176 @@ func encodeInt64(v int64) (b []byte, err error) {
 
 }
 
+// encodeUint64 encode long, values above the long range wrap to negative
+// unless strict
+func (o encodeOptions) encodeUint64(v uint64) (b []byte, err error) {
+	if v > math.MaxInt64 && o.strict {
+		return nil, fmt.Errorf("%d overflows long", v)
+	}
+	return encodeInt64(int64(v))
+}
+
 // encodeNull encode null
 func encodeNull(v interface{}) (b []byte, err error) {
 	b = append(b, 'N')
 	return
 }
 
-// encodeString encode string
+// encodeString encode string in chunks of at most CHUNK_SIZE utf-16 code
+// units, the length unit of hessian and java, a chunk never ends inside a
+// surrogate pair
 func encodeString(v string) (b []byte, err error) {
-	var (
-		lenB []byte
-		sBuf = *bytes.NewBufferString(v)
-		rLen = utf8.RuneCountInString(v)
-
-		sChunk = func(_len int) {
-			for i := 0; i < _len; i++ {
-				if r, s, err := sBuf.ReadRune(); s > 0 && err == nil {
-					b = append(b, []byte(string(r))...)
-				}
+	if "" == v {
+		return []byte{'S', 0, 0}, nil
+	}
+
+	var chunk []byte
+	for len(v) > 0 {
+		units := 0
+		chunk = chunk[:0]
+		for len(v) > 0 {
+			r, size := utf8.DecodeRuneInString(v)
+			if units+utf16Len(r) > CHUNK_SIZE {
+				break
 			}
+			units += utf16Len(r)
+			chunk = appendRune(chunk, r)
+			v = v[size:]
 		}
-	)
 
-	if "" == v {
-		if lenB, err = PackUint16(uint16(rLen)); err != nil {
-			b = nil
-			return
+		tag := byte('S')
+		if len(v) > 0 {
+			tag = 's'
+		}
+		lenB, err := PackUint16(uint16(units))
+		if err != nil {
+			return nil, err
 		}
-		b = append(b, 'S')
+		b = append(b, tag)
 		b = append(b, lenB...)
-		b = append(b, []byte{}...)
-		return
+		b = append(b, chunk...)
 	}
+	return b, nil
+}
 
-	for {
-		rLen = utf8.RuneCount(sBuf.Bytes())
-		if rLen == 0 {
-			break
-		}
-		if rLen > CHUNK_SIZE {
-			if lenB, err = PackUint16(uint16(CHUNK_SIZE)); err != nil {
-				b = nil
-				return
-			}
-			b = append(b, 's')
-			b = append(b, lenB...)
-			sChunk(CHUNK_SIZE)
-		} else {
-			if lenB, err = PackUint16(uint16(rLen)); err != nil {
-				b = nil
-				return
-			}
-			b = append(b, 'S')
-			b = append(b, lenB...)
-			sChunk(rLen)
-		}
+// utf16Len return the number of utf-16 code units of r
+func utf16Len(r rune) int {
+	if r > 0xffff {
+		return 2
 	}
-	return
+	return 1
+}
+
+// utf16Count return the number of utf-16 code units of s
+func utf16Count(s string) (n int) {
+	for _, r := range s {
+		n += utf16Len(r)
+	}
+	return n
+}
+
+// appendRune append the encoding of r to b the way java writes it: utf-8
+// for the BMP, and a surrogate pair of 3 bytes each, CESU-8, for runes out
+// of the BMP
+func appendRune(b []byte, r rune) []byte {
+	if r > 0xffff && r <= utf8.MaxRune {
+		r1, r2 := utf16.EncodeRune(r)
+		return appendSurrogate(appendSurrogate(b, r1), r2)
+	}
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return append(b, buf[:n]...)
+}
+
+// appendSurrogate append the 3 bytes of a surrogate code unit
+func appendSurrogate(b []byte, s rune) []byte {
+	return append(b, byte(0xe0|s>>12), byte(0x80|s>>6&0x3f), byte(0x80|s&0x3f))
+}
+
+// encodeClassString encode a map of class name with a single string field,
+// the form of java.math.BigDecimal, BigInteger and enums
+func encodeClassString(name, field, value string) (b []byte, err error) {
+	if b, err = encodeMapHead(name); err != nil {
+		return nil, err
+	}
+	k, err := encodeString(field)
+	if err != nil {
+		return nil, err
+	}
+	v, err := encodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, k...)
+	b = append(b, v...)
+	return append(b, 'z'), nil
 }
 
-// encodeList encode list for slice and array
-func encodeList(in interface{}) (b []byte, err error) {
+// encodeTypedList encode list of type name for slice and array, untyped if
+// name is empty
+func (o encodeOptions) encodeTypedList(name string, in interface{}) (b []byte, err error) {
 	if reflect.TypeOf(in).Kind() != reflect.Slice && reflect.TypeOf(in).Kind() != reflect.Array {
 		return nil, errors.New("invalid slice")
 	}
-	b = append(b, 'V')
-
 	v := reflect.ValueOf(in)
-	b_len, err := PackInt32(int32(v.Len()))
-	if err != nil {
+	if b, err = encodeListHead(name, v.Len()); err != nil {
 		return nil, err
 	}
-	b = append(b, 'l')
-	b = append(b, b_len...)
 
 	for i := 0; i < v.Len(); i++ {
-		tmp, err := Encode(v.Index(i).Interface())
+		tmp, err := o.encode(v.Index(i).Interface())
 		if nil != err {
 			log.Error(err)
 			return nil, err
 		}
 		b = append(b, tmp...)
 	}
-	b = append(b, 'z')
-	return b, nil
+	return append(b, 'z'), nil
+}
+
+// encodeListHead encode the head of a list of type name and length l
+func encodeListHead(name string, l int) (b []byte, err error) {
+	b = append(b, 'V')
+	if name != "" {
+		t_name, err := encodeType(name)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, t_name...)
+	}
+	b_len, err := PackInt32(int32(l))
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, 'l')
+	return append(b, b_len...), nil
 }
 
 // encodeStruct encode struct as map
-func encodeStruct(in interface{}) (b []byte, err error) {
+func (o encodeOptions) encodeStruct(in interface{}) (b []byte, err error) {
 	if reflect.TypeOf(in).Kind() != reflect.Struct {
 		return nil, errors.New("invalid struct")
 	}
 
 	v := reflect.ValueOf(in)
 	t := reflect.TypeOf(in)
-	name := getStructName(t)
-	b = append(b, 'M', 't')
-	l_name, err := PackInt16(int16(len(name)))
+	fields, err := structFields(t)
 	if err != nil {
 		return nil, err
 	}
-	b = append(b, l_name...)
-	b = append(b, name...)
-	for i := 0; i < t.NumField(); i++ {
-		tag := getFieldTag(t.Field(i))
-		if t.Field(i).Type.Name() == nameTypeName {
-			continue // pass hessian name field
+	if b, err = encodeMapHead(getStructName(t)); err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		fv := fieldValue(v, f.index)
+		if !fv.IsValid() || f.omitEmpty && isEmptyValue(fv) {
+			continue // promoted from a nil embedded pointer or omitted
 		}
-		tmp_k, err := encodeString(tag)
+		tmp_k, err := encodeString(f.name)
 		if err != nil {
 			return nil, err
 		}
-		tmp_v, err := Encode(v.Field(i).Interface())
+		tmp_v, err := o.encodeField(f, fv)
 		if err != nil {
 			return nil, err
 		}
@@ -329,20 +684,54 @@ func encodeStruct(in interface{}) (b []byte, err error) {
 	return b, nil
 }
 
-// encodeMap encode map
-func encodeMap(in interface{}) (b []byte, err error) {
+// encodeMapHead encode the head of a map typed name, untyped if name is empty
+func encodeMapHead(name string) (b []byte, err error) {
+	b = append(b, 'M')
+	if name == "" {
+		return b, nil
+	}
+	t_name, err := encodeType(name)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, t_name...), nil
+}
+
+// encodeType encode the type name of a list or map, its length counts
+// utf-16 code units like strings
+func encodeType(name string) (b []byte, err error) {
+	l_name, err := PackUint16(uint16(utf16Count(name)))
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, 't')
+	b = append(b, l_name...)
+	for _, r := range name {
+		b = appendRune(b, r)
+	}
+	return b, nil
+}
+
+// encodeTypedMap encode map of type name, untyped if name is empty
+func (o encodeOptions) encodeTypedMap(name string, in interface{}) (b []byte, err error) {
 	if reflect.TypeOf(in).Kind() != reflect.Map {
 		return nil, errors.New("invalid map")
 	}
-	b = append(b, 'M')
+	if b, err = encodeMapHead(name); err != nil {
+		return nil, err
+	}
 	v := reflect.ValueOf(in)
+	keys, err := o.mapKeys(v)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, key := range v.MapKeys() {
-		tmp_k, err := Encode(key.Interface())
+	for _, key := range keys {
+		tmp_k, err := o.encode(key.Interface())
 		if err != nil {
 			return nil, err
 		}
-		tmp_v, err := Encode(v.MapIndex(key).Interface())
+		tmp_v, err := o.encode(v.MapIndex(key).Interface())
 		if err != nil {
 			return nil, err
 		}
@@ -353,10 +742,80 @@ func encodeMap(in interface{}) (b []byte, err error) {
 	return b, nil
 }
 
-// getStructName return struct name
+// encodeSet encode a set, a map of struct{} values, as a list of type name
+func (o encodeOptions) encodeSet(name string, in interface{}) (b []byte, err error) {
+	v := reflect.ValueOf(in)
+	mapKeys, err := o.mapKeys(v)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]interface{}, 0, v.Len())
+	for _, key := range mapKeys {
+		keys = append(keys, key.Interface())
+	}
+	return o.encodeTypedList(name, keys)
+}
+
+// mapKeys return the keys of map v, sorted by their encoding if
+// deterministic. Comparing encodings orders keys of any kinds, by tag first,
+// though negative numbers come after positive ones. Keys of equal encodings,
+// like int(1) and int32(1), are sorted by kind and type.
+func (o encodeOptions) mapKeys(v reflect.Value) ([]reflect.Value, error) {
+	keys := v.MapKeys()
+	if !o.deterministic {
+		return keys, nil
+	}
+	sorted := make([]encodedKey, len(keys))
+	for i, key := range keys {
+		var err error
+		sorted[i].key = key
+		if sorted[i].encoded, err = o.encode(key.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if c := bytes.Compare(sorted[i].encoded, sorted[j].encoded); c != 0 {
+			return c < 0
+		}
+		ti, tj := sorted[i].typ(), sorted[j].typ()
+		if ti.Kind() != tj.Kind() {
+			return ti.Kind() < tj.Kind()
+		}
+		return ti.String() < tj.String()
+	})
+	for i := range sorted {
+		keys[i] = sorted[i].key
+	}
+	return keys, nil
+}
+
+// encodedKey is a map key and its encoding
+type encodedKey struct {
+	key     reflect.Value
+	encoded []byte
+}
+
+// typ return the dynamic type of the key
+func (k encodedKey) typ() reflect.Type {
+	if k.key.Kind() == reflect.Interface && !k.key.IsNil() {
+		return k.key.Elem().Type()
+	}
+	return k.key.Type()
+}
+
+// isSet tell whether t is a set, a map of struct{} values
+func isSet(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0
+}
+
+// getStructName return struct name, the registered java class name if any,
+// or the tag of its HessianName field, or the go type name
 func getStructName(t reflect.Type) (name string) {
+	if name, ok := registeredName(t); ok {
+		return name
+	}
 	nameField, ok := t.FieldByName(fieldName)
-	if ok {
+	if ok && nameField.Type.Name() == nameTypeName {
 		name = nameField.Tag.Get(hessianTag)
 	} else {
 		name = t.Name()
@@ -364,15 +823,6 @@ func getStructName(t reflect.Type) (name string) {
 	return
 }
 
-// getFieldTag return tag of field
-func getFieldTag(f reflect.StructField) string {
-	tag := f.Tag.Get(hessianTag)
-	if tag == "" {
-		tag = f.Name
-	}
-	return tag
-}
-
 // encodeObject encode object
 func encodeObject(v Any) (_ []byte, err error) {
 	valueV := reflect.ValueOf(v)
@@ -398,8 +848,25 @@ func encodeObject(v Any) (_ []byte, err error) {
 	b.WriteByte(byte(len(objectTypeField.String())))
 	b.WriteString(objectTypeField.String())
 
+	all, err := structFields(typeV)
+	if err != nil {
+		b.Reset()
+		return b.Bytes(), err
+	}
+	var fields []field
+	for _, f := range all {
+		if f.goName == ObjectType {
+			continue
+		}
+		fv := fieldValue(valueV, f.index)
+		if !fv.IsValid() || f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		fields = append(fields, f)
+	}
+
 	// Object Field Length
-	if lenField, err := PackInt16(0x90 + int16(typeV.NumField()) - 1); err != nil { // -1 是为了排除 Type Field
+	if lenField, err := PackInt16(0x90 + int16(len(fields))); err != nil {
 		b.Reset()
 		err = errors.New("can not count field length, error: " + err.Error())
 		return b.Bytes(), err
@@ -409,22 +876,15 @@ func encodeObject(v Any) (_ []byte, err error) {
 	}
 
 	// Every Field Name
-	for i := 0; i < typeV.NumField(); i++ {
-		if typeV.Field(i).Name == ObjectType {
-			continue
-		}
-		b.WriteByte(byte(len(typeV.Field(i).Name)))
-		b.WriteString(typeV.Field(i).Name)
+	for _, f := range fields {
+		b.WriteByte(byte(len(f.name)))
+		b.WriteString(f.name)
 	}
 
 	b.WriteByte('`')
 	// Object Value
-	for i := 0; i < typeV.NumField(); i++ {
-		if typeV.Field(i).Name == ObjectType {
-			continue
-		}
-		b.WriteByte(byte(len(valueV.Field(i).String())))
-		if value, err := encodeByType(valueV.Field(i), typeV.Field(i).Type.Name()); err != nil { // TODO Encode 无法识别复杂类型
+	for _, f := range fields {
+		if value, err := (encodeOptions{}).encodeField(f, fieldValue(valueV, f.index)); err != nil {
 			b.Reset()
 			err = errors.New("encode field value failed, error: " + err.Error())
 			return b.Bytes(), err
@@ -435,27 +895,3 @@ func encodeObject(v Any) (_ []byte, err error) {
 
 	return b.Bytes(), nil
 }
-
-func encodeByType(v reflect.Value, t string) ([]byte, error) {
-	switch t {
-	case "string":
-		// return []byte(v.String()), nil
-		return Encode(v.String())
-	case "int":
-		return Encode(v.Int())
-	case "int32":
-		return Encode(int32(v.Int()))
-	case "int64":
-		return Encode(v.Int())
-	case "bool":
-		return Encode(v.Bool())
-	case "[]byte":
-		return Encode(v.Bytes())
-	case "float64":
-		return Encode(v.Float())
-	case "nil":
-		return Encode(nil)
-	default:
-		return nil, errors.New("unsupport type in object...")
-	}
-}
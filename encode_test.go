@@ -66,6 +66,33 @@ func Test_encode_time(t *testing.T) {
 	}
 	want := []byte{0x64, 0x00, 0x00, 0x01, 0x44, 0x15, 0x49, 0x34, 0x78}
 	checkResult(want, b, t)
+
+	// milliseconds are rounded down, also before the epoch
+	for _, test := range [][2]time.Time{
+		{{}, {}},
+		{time.Date(3000, 1, 2, 3, 4, 5, 6e6, time.UTC), time.Date(3000, 1, 2, 3, 4, 5, 6e6, time.UTC)},
+		{time.Unix(-1, 500000), time.Unix(-1, 0)},
+		{time.Unix(0, -1), time.Unix(0, -1e6)},
+	} {
+		b, err := Encode(test[0])
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		h := NewHessian(bytes.NewReader(b))
+		h.Location = time.UTC
+		v, err := h.Parse()
+		if d, ok := v.(time.Time); err != nil || !ok || !d.Equal(test[1]) {
+			t.Fatalf("want %v, got %v, %v", test[1], v, err)
+		}
+	}
+	for _, v := range []time.Time{time.Unix(1<<62, 0), time.Unix(-1<<62, 0), time.Unix(-1, 500000)} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.SetStrict(true)
+		if err := e.Encode(v); err == nil {
+			t.Fatalf("want strict error for %v", v)
+		}
+	}
 }
 
 func Test_encode_double(t *testing.T) {
@@ -90,6 +117,41 @@ func Test_encode_int_long(t *testing.T) {
 	}
 }
 
+type userID int64
+
+func Test_encode_numeric_kinds(t *testing.T) {
+	for _, c := range []struct {
+		v    interface{}
+		want []byte
+	}{
+		{int8(-1), []byte{'I', 0xff, 0xff, 0xff, 0xff}},
+		{int16(300), []byte{'I', 0, 0, 1, 44}},
+		{uint8(255), []byte{'I', 0, 0, 0, 255}},
+		{uint16(65535), []byte{'I', 0, 0, 255, 255}},
+		{uint(7), []byte{'I', 0, 0, 0, 7}},
+		{uint32(7), []byte{'L', 0, 0, 0, 0, 0, 0, 0, 7}},
+		{userID(7), []byte{'L', 0, 0, 0, 0, 0, 0, 0, 7}},
+		{uint64(1<<64 - 1), []byte{'L', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{float32(0.5), []byte{'D', 0x3f, 0xe0, 0, 0, 0, 0, 0, 0}},
+	} {
+		b, err := Encode(c.v)
+		if err != nil {
+			t.Fatalf("%T: %v", c.v, err)
+		}
+		checkResult(c.want, b, t)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetStrict(true)
+	if err := e.Encode([]interface{}{uint64(1 << 63)}); err == nil {
+		t.Fatalf("want overflow error in strict mode")
+	}
+	if _, err := Encode(complex(1, 2)); err == nil {
+		t.Fatalf("want error for complex")
+	}
+}
+
 func Test_encode_string(t *testing.T) {
 	b, err := Encode("亡命之徒")
 	if err != nil || b == nil {
@@ -143,3 +205,262 @@ func Test_encode_object(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type baseEntity struct {
+	ID int64
+}
+
+type Audit struct {
+	Creator string
+	Version int32
+}
+
+type auditNote struct {
+	Note string
+}
+
+type auditedOrder struct {
+	Name HessianName `hs:"com.acme.AuditedOrder"`
+	*Audit
+	Title   string
+	Version int64 // hides Audit.Version
+	Extra   interface{}
+	Next    *auditedOrder
+	secret  string
+	baseEntity
+	*auditNote // unexported pointer, not promoted
+}
+
+func Test_encode_struct_fields(t *testing.T) {
+	in := auditedOrder{Audit: &Audit{Creator: "bob", Version: 1}, Title: "t", Version: 2, Extra: int32(3), secret: "s", baseEntity: baseEntity{7}, auditNote: &auditNote{"n"}}
+	b, err := Encode(in)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	m := v.(map[interface{}]interface{})
+	if len(m) != 6 || m["ID"] != int64(7) || m["Creator"] != "bob" || m["Version"] != int64(2) || m["Extra"] != int32(3) || m["Next"] != nil {
+		t.Fatalf("unexpected map %#v", m)
+	}
+
+	var out auditedOrder
+	if err = Bind(v, &out); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if out.Audit == nil || out.ID != 7 || out.Creator != "bob" || out.Version != 2 || out.Title != "t" || out.Extra != int32(3) {
+		t.Fatalf("unexpected struct %+v", out)
+	}
+
+	in.Audit = nil
+	if b, err = Encode(in); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if bytes.Contains(b, []byte("Creator")) {
+		t.Fatalf("want no field of nil embedded struct: %q", b)
+	}
+}
+
+type taggedOrder struct {
+	ID     int       `hs:"id,long"`
+	Count  uint8     `hs:"count,int"`
+	Rate   int32     `hs:"rate,double"`
+	Note   string    `hs:"note,omitempty"`
+	Items  []string  `hs:"items,omitempty,list=java.util.ArrayList"`
+	Cache  string    `hs:"-"`
+	Parent *int      `hs:"parent,long"`
+	Hidden time.Time `hs:",omitempty"`
+}
+
+func Test_encode_tag_options(t *testing.T) {
+	in := taggedOrder{ID: 7, Count: 2, Rate: 3, Items: []string{"a"}, Cache: "c", Hidden: time.Now()}
+	b, err := Encode(in)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if bytes.Contains(b, []byte("note")) || bytes.Contains(b, []byte("Cache")) ||
+		!bytes.Contains(b, []byte("java.util.ArrayList")) {
+		t.Fatalf("unexpected encoding %q", b)
+	}
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	m := v.(map[interface{}]interface{})
+	if m["id"] != int64(7) || m["count"] != int32(2) || m["rate"] != float64(3) || m["parent"] != nil {
+		t.Fatalf("unexpected map %#v", m)
+	}
+
+	m["Cache"] = "ignored"
+	var out taggedOrder
+	if err = Bind(m, &out); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if out.ID != 7 || out.Count != 2 || out.Rate != 3 || len(out.Items) != 1 || out.Cache != "" {
+		t.Fatalf("unexpected struct %+v", out)
+	}
+
+	if _, err = Encode(struct {
+		N string `hs:"n,long"`
+	}{"x"}); err == nil {
+		t.Fatalf("want error for string hinted as long")
+	}
+	type typo struct {
+		N string `hs:"n,omitmepty"`
+	}
+	if _, err = Encode(typo{"x"}); err == nil {
+		t.Fatalf("want error for unknown tag option")
+	}
+	if err = Bind(m, &typo{}); err == nil {
+		t.Fatalf("want error for unknown tag option")
+	}
+}
+
+type listItem struct {
+	Name HessianName `hs:"com.acme.ListItem"`
+	N    int32
+}
+
+func Test_encode_typed_list(t *testing.T) {
+	registerTestType(t, "com.acme.ListItem", listItem{})
+	registerTestListType(t, "[com.acme.ListItem", listItem{})
+
+	items := []listItem{{N: 1}, {N: 2}}
+	b, err := Encode(items)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !bytes.HasPrefix(b, append([]byte{'V', 't', 0, 18}, "[com.acme.ListItem"...)) {
+		t.Fatalf("unexpected list %q", b)
+	}
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if got, ok := v.([]listItem); !ok || len(got) != 2 || got[1].N != 2 {
+		t.Fatalf("want %v, got %#v", items, v)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetHessian2(true)
+	e.Encode([]interface{}{TypedList{Type: "java.util.ArrayList", Items: []interface{}{int32(1)}}, make([]int32, 8)})
+	if e.Err() != nil {
+		t.Fatalf("error: %v", e.Err())
+	}
+	want := []byte{0x78 + 2, 0x71, 19}
+	want = append(want, "java.util.ArrayList"...)
+	want = append(want, 0x91, 'X', 0x98, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90, 0x90)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("want %v..., got %v", want, buf.Bytes())
+	}
+}
+
+type scores map[string]int32
+
+type collections struct {
+	Tags   map[string]struct{}
+	Sorted map[int32]struct{} `hs:"sorted,list=java.util.TreeSet"`
+	Index  map[string]int32   `hs:"index,map=java.util.TreeMap"`
+	Scores scores
+	Plain  map[string]interface{}
+}
+
+func Test_encode_typed_maps(t *testing.T) {
+	registerTestType(t, "java.util.LinkedHashMap", scores{})
+
+	in := collections{
+		Tags:   map[string]struct{}{"a": {}, "b": {}},
+		Sorted: map[int32]struct{}{3: {}},
+		Index:  map[string]int32{"x": 1},
+		Scores: scores{"bob": 2},
+		Plain:  map[string]interface{}{"k": "v"},
+	}
+	b, err := Encode(in)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	for _, name := range []string{"java.util.HashSet", "java.util.TreeSet", "java.util.TreeMap", "java.util.LinkedHashMap"} {
+		if !bytes.Contains(b, []byte(name)) {
+			t.Fatalf("%s not encoded: %q", name, b)
+		}
+	}
+
+	v, err := NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	var out collections
+	if err = Bind(v, &out); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, ok := out.Tags["b"]; !ok || len(out.Tags) != 2 || len(out.Sorted) != 1 ||
+		out.Index["x"] != 1 || out.Scores["bob"] != 2 || out.Plain["k"] != "v" {
+		t.Fatalf("unexpected struct %+v", out)
+	}
+}
+
+func Test_encode_deterministic(t *testing.T) {
+	in := map[interface{}]interface{}{
+		"b": 1, "a": map[string]int32{"y": 1, "x": 2, "z": 3}, int32(2): nil, int32(1): true,
+		1.5: "d", false: map[int32]struct{}{5: {}, 4: {}, 6: {}},
+	}
+	var first []byte
+	for i := 0; i < 20; i++ {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.SetDeterministic(true)
+		if err := e.Encode(in); err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		if i == 0 {
+			first = buf.Bytes()
+			continue
+		}
+		checkResult(first, buf.Bytes(), t)
+	}
+	if !bytes.HasPrefix(first, []byte{'M', 'D'}) {
+		t.Fatalf("want double key first, got %q", first)
+	}
+
+	// keys of equal encodings are sorted by kind
+	same := map[interface{}]interface{}{int32(1): "int32", uint8(1): "uint8", 1: "int", int16(1): "int16"}
+	want := []byte{'M'}
+	for _, v := range []string{"int", "int16", "int32", "uint8"} {
+		want = append(want, 'I', 0, 0, 0, 1, 'S', 0, byte(len(v)))
+		want = append(want, v...)
+	}
+	want = append(want, 'z')
+	for i := 0; i < 20; i++ {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.SetDeterministic(true)
+		if err := e.Encode(same); err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		checkResult(want, buf.Bytes(), t)
+	}
+}
+
+// uintWriter write itself with the options of the encoder
+type uintWriter struct{ V uint64 }
+
+func (w *uintWriter) WriteHessian(e *Encoder) error {
+	e.Encode(w.V)
+	return e.Err()
+}
+
+func Test_encode_writer_options(t *testing.T) {
+	in := []interface{}{uintWriter{1 << 63}}
+	if _, err := Encode(in); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetStrict(true)
+	if err := e.Encode(in); err == nil {
+		t.Fatalf("want strict error inside a writer")
+	}
+}
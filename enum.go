@@ -0,0 +1,142 @@
+package gohessian
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+const enumField = "name"
+
+// enum is a java enum class mapped to a go type
+type enum struct {
+	class     string
+	typ       reflect.Type
+	constants map[string]reflect.Value // by java name
+	names     map[interface{}]string   // by go constant
+}
+
+// enums registered by RegisterEnum
+var enums = struct {
+	sync.RWMutex
+	byClass map[string]*enum
+	byType  map[reflect.Type]*enum
+}{
+	byClass: make(map[string]*enum),
+	byType:  make(map[reflect.Type]*enum),
+}
+
+// RegisterEnum map the java enum class name to the go type of values, which
+// are its constants. A constant is named by its String method, or by its
+// value for string types. Constants are encoded as the enum class with their
+// name, like java does, and the enum class in replies is decoded back into
+// the constant. It panics if values are empty, of different types or
+// unnamed.
+//
+//	type Status string
+//	const (
+//		Active  Status = "ACTIVE"
+//		Deleted Status = "DELETED"
+//	)
+//	gohessian.RegisterEnum("com.acme.Status", Active, Deleted)
+func RegisterEnum(class string, values ...interface{}) {
+	if len(values) == 0 {
+		panic("gohessian: no constant for enum " + class)
+	}
+	en := &enum{
+		class:     class,
+		typ:       reflect.TypeOf(values[0]),
+		constants: make(map[string]reflect.Value),
+		names:     make(map[interface{}]string),
+	}
+	for _, v := range values {
+		if reflect.TypeOf(v) != en.typ {
+			panic(fmt.Sprintf("gohessian: enum %s mixes %v and %T", class, en.typ, v))
+		}
+		name := enumName(v)
+		if name == "" {
+			panic(fmt.Sprintf("gohessian: enum %s constant %v has no name", class, v))
+		}
+		en.constants[name] = reflect.ValueOf(v)
+		en.names[v] = name
+	}
+
+	enums.Lock()
+	defer enums.Unlock()
+	enums.byClass[class] = en
+	enums.byType[en.typ] = en
+}
+
+// enumName return the java name of a constant
+func enumName(v interface{}) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+	if reflect.TypeOf(v).Kind() == reflect.String {
+		return reflect.ValueOf(v).String()
+	}
+	return ""
+}
+
+// lookupEnum return the enum registered for the go type
+func lookupEnum(t reflect.Type) (en *enum, ok bool) {
+	enums.RLock()
+	defer enums.RUnlock()
+	en, ok = enums.byType[t]
+	return
+}
+
+// lookupEnumClass return the enum registered for the java class name
+func lookupEnumClass(class string) (en *enum, ok bool) {
+	enums.RLock()
+	defer enums.RUnlock()
+	en, ok = enums.byClass[class]
+	return
+}
+
+// encode encode the constant v
+func (en *enum) encode(v interface{}) ([]byte, error) {
+	name, ok := en.names[v]
+	if !ok {
+		return nil, fmt.Errorf("%v is not a constant of enum %s", v, en.class)
+	}
+	return encodeClassString(en.class, enumField, name)
+}
+
+// constant return the constant of a decoded enum, given as its map or name
+func (en *enum) constant(data interface{}) (reflect.Value, error) {
+	switch d := data.(type) {
+	case TypedMap:
+		return en.constant(d.Entries)
+	case map[interface{}]interface{}:
+		data = d[enumField]
+	}
+	name, ok := data.(string)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("cannot convert %T to enum %s", data, en.class)
+	}
+	c, ok := en.constants[name]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown constant %q of enum %s", name, en.class)
+	}
+	return c, nil
+}
+
+// extractEnum bind a decoded enum to value of a registered enum type, ok is
+// false for other types
+func extractEnum(data reflect.Value, value reflect.Value) (ok bool, err error) {
+	en, ok := lookupEnum(value.Type())
+	if !ok || !data.IsValid() {
+		return ok, nil
+	}
+	if data.Type() == en.typ {
+		value.Set(data)
+		return true, nil
+	}
+	c, err := en.constant(data.Interface())
+	if err != nil {
+		return true, err
+	}
+	value.Set(c)
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package gohessian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Fault is a hessian fault replied by the service
+type Fault struct {
+	Code    string
+	Message string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%s : %s", f.Code, f.Message)
+}
+
+// DecodeError is returned when a reply can't be decoded, for a short read
+// or invalid data. Offset is the number of bytes read before the failure and
+// Tag the tag of the value being decoded.
+type DecodeError struct {
+	Offset int64
+	Tag    byte
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("hessian: decode %q at offset %d: %v", e.Tag, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError is returned when the service response with a non 200 status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Status
+}
+
+// ErrorClass is the category of an error returned by a call
+type ErrorClass int
+
+const (
+	// ClassOther is an error neither from transport nor from the service
+	ClassOther ErrorClass = iota
+	// ClassTransport is a network failure or an unavailable gateway, the
+	// request may not have reached the service
+	ClassTransport
+	// ClassFault is a hessian fault, the service has handled the request
+	ClassFault
+)
+
+// Classify return the category of err
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ClassOther
+	}
+	var fault *Fault
+	if errors.As(err, &fault) {
+		return ClassFault
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ClassOther
+	}
+	if errors.Is(err, ErrNoEndpoint) {
+		return ClassTransport
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case 502, 503, 504:
+			return ClassTransport
+		}
+		return ClassOther
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ClassTransport
+	}
+	return ClassOther
+}
@@ -6,8 +6,11 @@ import (
 	log "github.com/cihub/seelog"
 )
 
-// extractData help extracting map data into struct
-func extractData(data reflect.Value, typ reflect.Type) (rslt reflect.Value) {
+var unmarshalerType = reflect.TypeOf((*HessianUnmarshaler)(nil)).Elem()
+
+// extractData help extracting map data into struct, err is the first error
+// returned by a HessianUnmarshaler
+func extractData(data reflect.Value, typ reflect.Type) (rslt reflect.Value, err error) {
 	rslt = reflect.New(typ)
 	value := rslt.Elem()
 	defer func() {
@@ -24,98 +27,163 @@ func extractData(data reflect.Value, typ reflect.Type) (rslt reflect.Value) {
 		value = value.Elem()
 	}
 
-	for data.Type().Kind() == reflect.Interface ||
-		(data.Type().Kind() == reflect.Ptr && !reflect.ValueOf(data).IsNil()) {
+	for data.IsValid() && (data.Type().Kind() == reflect.Interface ||
+		(data.Type().Kind() == reflect.Ptr && !data.IsNil())) {
 		data = data.Elem()
 	}
+
+	// bind typed values by their content unless they are the target
+	if data.IsValid() && !data.Type().AssignableTo(typ) {
+		switch d := data.Interface().(type) {
+		case TypedMap:
+			data = reflect.ValueOf(d.Entries)
+		case TypedList:
+			data = reflect.ValueOf(d.Items)
+		}
+	}
+
+	// values decoded as registered types
+	if data.IsValid() && data.Type().AssignableTo(typ) {
+		value.Set(data)
+		return
+	}
+
+	if reflect.PtrTo(typ).Implements(unmarshalerType) {
+		var d interface{}
+		if data.IsValid() {
+			d = data.Interface()
+		}
+		err = value.Addr().Interface().(HessianUnmarshaler).UnmarshalHessian(d)
+		return
+	}
 	log.Trace("data: ", data.Interface(), ", kind: ", data.Kind())
 	log.Trace("type: ", typ, ", kind: ", typ.Kind())
 
+	if ok, err := extractBig(data, value); ok {
+		return rslt, err
+	}
+	if ok, err := extractEnum(data, value); ok {
+		return rslt, err
+	}
+
+	var v reflect.Value
 	switch typ.Kind() {
 	case reflect.Struct:
 		if data.Kind() != reflect.Map {
 			return
 		}
-		value.Set(extractStruct(data.Interface(), typ))
+		v, err = extractStruct(data.Interface(), typ)
+		value.Set(v)
 	case reflect.Slice:
 		if data.Kind() != reflect.Slice {
 			return
 		}
-		value.Set(extractSlice(data.Interface(), typ))
+		v, err = extractSlice(data.Interface(), typ)
+		value.Set(v)
 	case reflect.Map:
+		if data.Kind() == reflect.Slice && isSet(typ) {
+			v, err = extractSet(data.Interface(), typ)
+			value.Set(v)
+			return
+		}
 		if data.Kind() != reflect.Map {
 			return
 		}
-		value.Set(extractMap(data.Interface(), typ))
+		v, err = extractMap(data.Interface(), typ)
+		value.Set(v)
 	default:
 		if data.Kind() == reflect.Map {
 			k := data.MapKeys()[0]
 			data = data.MapIndex(k)
 		}
+		// numbers sent as another java type, like a long hinted field
+		if isNumber(data.Kind()) && isNumber(typ.Kind()) {
+			data = data.Convert(typ)
+		}
 		value.Set(data)
 	}
 	return
 }
 
-func extractStruct(data interface{}, typ reflect.Type) (value reflect.Value) {
+func extractStruct(data interface{}, typ reflect.Type) (value reflect.Value, err error) {
 	if typ.Kind() != reflect.Struct {
-		return value
+		return value, nil
 	}
 	dataMap := data.(map[interface{}]interface{})
 	value = reflect.New(typ).Elem()
-	for i := 0; i < typ.NumField(); i++ {
-		tf := typ.Field(i)
-		vf := value.Field(i)
-		if !vf.CanSet() {
-			return value
-		}
-
-		if tf.Type.Name() == nameTypeName {
-			continue // pass hessian name field
-		}
-
+	fields, err := structFields(typ)
+	if err != nil {
+		return value, err
+	}
+	for _, f := range fields {
 		var name string
 		var vd interface{}
-		var ok bool
-		tag := tf.Tag.Get(hessianTag)
-		if len(tag) > 0 {
-			d, ok := dataMap[tag]
-			if ok {
-				name = tag
-				vd = d
-			}
-		}
-		d, ok := dataMap[tf.Name]
-		if ok {
-			name = tf.Name
+		if d, ok := dataMap[f.name]; ok {
+			name = f.name
+			vd = d
+		}
+		if d, ok := dataMap[f.goName]; ok {
+			name = f.goName
 			vd = d
 		}
 		if len(name) <= 0 || vd == nil {
 			continue
 		}
 		log.Trace("parsing: ", name)
-		vf.Set(extractData(reflect.ValueOf(vd), tf.Type))
+		fv, err := extractData(reflect.ValueOf(vd), f.typ)
+		if err != nil {
+			return value, err
+		}
+		settableField(value, f.index).Set(fv)
 	}
-	return value
+	return value, nil
 }
 
-func extractSlice(data interface{}, typ reflect.Type) (value reflect.Value) {
+func extractSlice(data interface{}, typ reflect.Type) (value reflect.Value, err error) {
 	dataSlice := reflect.ValueOf(data)
 	value = reflect.MakeSlice(typ, 0, dataSlice.Len())
 	for i := 0; i < dataSlice.Len(); i++ {
-		v := extractData(dataSlice.Index(i), typ.Elem())
+		v, err := extractData(dataSlice.Index(i), typ.Elem())
+		if err != nil {
+			return value, err
+		}
 		value = reflect.Append(value, v)
 	}
-	return value
+	return value, nil
 }
 
-func extractMap(data interface{}, typ reflect.Type) (value reflect.Value) {
+func extractMap(data interface{}, typ reflect.Type) (value reflect.Value, err error) {
 	value = reflect.MakeMap(typ)
 	keys := reflect.ValueOf(data).MapKeys()
 	for _, kd := range keys {
-		kv := extractData(kd, typ.Key())
-		vv := extractData(reflect.ValueOf(data).MapIndex(kd), typ.Elem())
+		kv, err := extractData(kd, typ.Key())
+		if err != nil {
+			return value, err
+		}
+		vv, err := extractData(reflect.ValueOf(data).MapIndex(kd), typ.Elem())
+		if err != nil {
+			return value, err
+		}
 		value.SetMapIndex(kv, vv)
 	}
-	return value
+	return value, nil
+}
+
+// extractSet bind a decoded list, like a java.util.HashSet, to a set
+func extractSet(data interface{}, typ reflect.Type) (value reflect.Value, err error) {
+	value = reflect.MakeMap(typ)
+	dataSlice := reflect.ValueOf(data)
+	for i := 0; i < dataSlice.Len(); i++ {
+		kv, err := extractData(dataSlice.Index(i), typ.Key())
+		if err != nil {
+			return value, err
+		}
+		value.SetMapIndex(kv, reflect.Zero(typ.Elem()))
+	}
+	return value, nil
+}
+
+// isNumber tell whether k is an integer or float kind
+func isNumber(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
 }
@@ -0,0 +1,257 @@
+package gohessian
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// field is a struct field encoded as an entry of the struct map
+type field struct {
+	name      string // hessian name, the tag or the go name
+	goName    string
+	index     []int // index path through embedded structs
+	typ       reflect.Type
+	omitEmpty bool
+	hint      string // java type of a number: int, long or double
+	listType  string // java class of a list or set
+	mapType   string // java class of a map
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// structFields return the fields of struct type t as hessian map entries:
+//	- unexported fields and HessianName fields are skipped
+//	- fields of embedded structs are promoted, like the fields of a java
+//	  superclass, unless the embedded field is tagged, also of unexported
+//	  structs unless embedded by pointer
+//	- a promoted field is hidden by a field of the same name closer to t
+//	- interface fields hold their dynamic value and nil pointers are null
+//	- fields tagged "-" are skipped, see parseFieldTag for tag options
+func structFields(t reflect.Type) (fields []field, err error) {
+	var all []field
+	if err = collectFields(t, nil, map[reflect.Type]bool{}, &all); err != nil {
+		return nil, err
+	}
+	pos := make(map[string]int)
+	for _, f := range all {
+		if i, ok := pos[f.name]; ok {
+			if len(f.index) < len(fields[i].index) {
+				fields[i] = f
+			}
+			continue
+		}
+		pos[f.name] = len(fields)
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// collectFields append the fields of t at index to all, seen are the
+// embedded types being walked
+func collectFields(t reflect.Type, index []int, seen map[reflect.Type]bool, all *[]field) error {
+	seen[t] = true
+	defer delete(seen, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous || sf.Type.Name() == nameTypeName || sf.Tag.Get(hessianTag) == "-" {
+			continue // unexported, hessian name or skipped field
+		}
+		idx := append(append([]int(nil), index...), i)
+		et := embeddedStruct(sf)
+		if sf.PkgPath != "" && (et == nil || sf.Type.Kind() == reflect.Ptr) {
+			continue // unexported and not promoted, or can't be allocated
+		}
+		if et != nil {
+			if !seen[et] {
+				if err := collectFields(et, idx, seen, all); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		f, ok, err := parseFieldTag(sf)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		f.index = idx
+		*all = append(*all, f)
+	}
+	return nil
+}
+
+// parseFieldTag parse the hs tag of sf, ok is false if the field is skipped.
+// The tag is the hessian name followed by options, others are an error:
+//	- omitempty: omit false, 0, nil and empty values
+//	- int, long or double: encode a number as this java type
+//	- list=class: encode a slice or a set as a list of the java class
+//	- map=class: encode a map as a map of the java class
+//
+//	Count int    `hs:"count,long"`
+//	Items []Item `hs:"items,omitempty,list=java.util.ArrayList"`
+//	Index map[string]int32 `hs:"index,map=java.util.TreeMap"`
+//	Cache string `hs:"-"`
+func parseFieldTag(sf reflect.StructField) (f field, ok bool, err error) {
+	tag := sf.Tag.Get(hessianTag)
+	if tag == "-" {
+		return f, false, nil
+	}
+	opts := strings.Split(tag, ",")
+	f.name, f.goName, f.typ = opts[0], sf.Name, sf.Type
+	if f.name == "" {
+		f.name = sf.Name
+	}
+	return f, true, f.parseOptions(opts[1:])
+}
+
+// parseOptions set the tag options of f
+func (f *field) parseOptions(opts []string) error {
+	for _, opt := range opts {
+		switch {
+		case opt == "omitempty":
+			f.omitEmpty = true
+		case opt == "int", opt == "long", opt == "double":
+			f.hint = opt
+		case strings.HasPrefix(opt, "list=") && len(opt) > len("list="):
+			f.listType = strings.TrimPrefix(opt, "list=")
+		case strings.HasPrefix(opt, "map=") && len(opt) > len("map="):
+			f.mapType = strings.TrimPrefix(opt, "map=")
+		default:
+			return fmt.Errorf("field %s: invalid tag option %q", f.goName, opt)
+		}
+	}
+	return nil
+}
+
+// embeddedStruct return the struct type of an embedded field whose fields
+// are promoted, nil if the field is encoded as a whole
+func embeddedStruct(sf reflect.StructField) reflect.Type {
+	if !sf.Anonymous || sf.Tag.Get(hessianTag) != "" {
+		return nil
+	}
+	t := sf.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || t == bigIntType || t == bigFloatType ||
+		isMarshaler(reflect.PtrTo(t)) {
+		return nil
+	}
+	return t
+}
+
+// fieldValue return the field of v at index, invalid if it is promoted from
+// a nil embedded pointer
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// settableField return the field of v at index, allocating nil embedded
+// pointers on the way
+func settableField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// isEmptyValue tell whether v is omitted by omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// encodeField encode the value v of field f following its tag options
+func (o encodeOptions) encodeField(f field, v reflect.Value) ([]byte, error) {
+	if f.hint == "" && f.listType == "" && f.mapType == "" {
+		return o.encode(v.Interface())
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return encodeNull(nil)
+		}
+		v = v.Elem()
+	}
+
+	if f.listType != "" {
+		if isSet(v.Type()) {
+			return o.encodeSet(f.listType, v.Interface())
+		}
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, fmt.Errorf("field %s: cannot encode %v as list", f.goName, v.Type())
+		}
+		return o.encodeTypedList(f.listType, v.Interface())
+	}
+	if f.mapType != "" {
+		if v.Kind() != reflect.Map || isSet(v.Type()) {
+			return nil, fmt.Errorf("field %s: cannot encode %v as map", f.goName, v.Type())
+		}
+		return o.encodeTypedMap(f.mapType, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return o.encodeHinted(f, v.Int(), float64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 && f.hint != "double" {
+			return o.encodeUint64(v.Uint())
+		}
+		return o.encodeHinted(f, int64(v.Uint()), float64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		if f.hint == "double" {
+			return encodeFloat64(v.Float())
+		}
+	}
+	return nil, fmt.Errorf("field %s: cannot encode %v as %s", f.goName, v.Type(), f.hint)
+}
+
+// encodeHinted encode the integer i, also given as float d, as the java
+// type hint of f, lossy conversions fail when strict
+func (o encodeOptions) encodeHinted(f field, i int64, d float64) ([]byte, error) {
+	switch f.hint {
+	case "int":
+		if o.strict && (i < math.MinInt32 || i > math.MaxInt32) {
+			return nil, fmt.Errorf("field %s: %d overflows int", f.goName, i)
+		}
+		return encodeInt32(int32(i))
+	case "double":
+		if o.strict && (i > 1<<53 || i < -1<<53) {
+			return nil, fmt.Errorf("field %s: %d is not exact as double", f.goName, i)
+		}
+		return encodeFloat64(d)
+	}
+	return encodeInt64(i)
+}
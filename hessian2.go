@@ -0,0 +1,263 @@
+package gohessian
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// encodeListHead2 encode the head of a hessian 2.0 fixed length list of
+// type name and length l:
+//	x70-x77 type value*   typed list of length 0-7
+//	'V' type int value*   typed list
+//	x78-x7f value*        untyped list of length 0-7
+//	'X' int value*        untyped list
+func encodeListHead2(name string, l int) (b []byte, err error) {
+	if name == "" {
+		if l <= 7 {
+			return []byte{byte(0x78 + l)}, nil
+		}
+		b = append(b, 'X')
+		tmp, err := encodeInt2(int32(l))
+		if err != nil {
+			return nil, err
+		}
+		return append(b, tmp...), nil
+	}
+
+	if l <= 7 {
+		b = append(b, byte(0x70+l))
+	} else {
+		b = append(b, 'V')
+	}
+	tmp, err := encodeString2(name)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, tmp...)
+	if l <= 7 {
+		return b, nil
+	}
+	if tmp, err = encodeInt2(int32(l)); err != nil {
+		return nil, err
+	}
+	return append(b, tmp...), nil
+}
+
+// encodeInt2 encode the compact hessian 2.0 int
+func encodeInt2(v int32) (b []byte, err error) {
+	switch {
+	case v >= -16 && v <= 47:
+		return []byte{byte(0x90 + v)}, nil
+	case v >= -2048 && v <= 2047:
+		return []byte{byte(0xc8 + v>>8), byte(v)}, nil
+	case v >= -262144 && v <= 262143:
+		return []byte{byte(0xd4 + v>>16), byte(v >> 8), byte(v)}, nil
+	}
+	return encodeInt32(v)
+}
+
+// encodeString2 encode a hessian 2.0 string, chunks but the last are 'R'
+// and the last is compact when short
+func encodeString2(v string) (b []byte, err error) {
+	for {
+		units, chunk := 0, []byte(nil)
+		for len(v) > 0 {
+			r, size := utf8.DecodeRuneInString(v)
+			if units+utf16Len(r) > CHUNK_SIZE {
+				break
+			}
+			units += utf16Len(r)
+			chunk = appendRune(chunk, r)
+			v = v[size:]
+		}
+		switch {
+		case len(v) > 0:
+			b = append(b, 'R', byte(units>>8), byte(units))
+		case units <= 31:
+			b = append(b, byte(units))
+		case units <= 1023:
+			b = append(b, byte(0x30+units>>8), byte(units))
+		default:
+			b = append(b, 'S', byte(units>>8), byte(units))
+		}
+		b = append(b, chunk...)
+		if len(v) == 0 {
+			return b, nil
+		}
+	}
+}
+
+// hessian2 transcode the hessian 1.0 encoding of a value to hessian 2.0, so
+// that marshalers, enums and java.time values, which write hessian 1.0, are
+// written in the grammar of the message
+func hessian2(b []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	n, err := NewHessian(bytes.NewReader(b)).Decode()
+	if err != nil {
+		return nil, err
+	}
+	return n.appendHessian2(nil)
+}
+
+// appendHessian2 append the hessian 2.0 encoding of n to b
+func (n Node) appendHessian2(b []byte) ([]byte, error) {
+	var tmp []byte
+	var err error
+	switch n.Tag {
+	case 'N', 'T', 'F':
+		return append(b, n.Tag), nil
+	case 'I':
+		tmp, err = encodeInt2(n.Value.(int32))
+	case 'L':
+		tmp = encodeLong2(n.Value.(int64))
+	case 'D':
+		tmp = encodeDouble2(n.Value.(float64))
+	case 'd':
+		tmp = encodeDate2(n.Value.(int64))
+	case 'S', 'X': // hessian 2.0 has no xml
+		var s string
+		if s, err = n.text(); err == nil {
+			tmp, err = encodeString2(s)
+		}
+	case 'B':
+		var data []byte
+		for _, c := range n.Chunks {
+			data = append(data, c.Data...)
+		}
+		tmp = encodeBinary2(data)
+	case 'V':
+		if tmp, err = encodeListHead2(n.Type, len(n.Items)); err != nil {
+			return nil, err
+		}
+		return appendItems2(append(b, tmp...), n.Items)
+	case 'M':
+		b = append(b, 'H')
+		if n.Type != "" {
+			b[len(b)-1] = 'M'
+			if tmp, err = encodeString2(n.Type); err != nil {
+				return nil, err
+			}
+			b = append(b, tmp...)
+		}
+		if b, err = appendItems2(b, n.Items); err != nil {
+			return nil, err
+		}
+		return append(b, 'Z'), nil
+	case 'R':
+		b = append(b, 'Q')
+		tmp, err = encodeInt2(n.Value.(int32))
+	default:
+		return nil, fmt.Errorf("node %q has no hessian 2.0 encoding", n.Tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(b, tmp...), nil
+}
+
+// appendItems2 append the hessian 2.0 encoding of items to b
+func appendItems2(b []byte, items []Node) (_ []byte, err error) {
+	for _, item := range items {
+		if b, err = item.appendHessian2(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// text return the string of the chunks of a string node
+func (n Node) text() (string, error) {
+	var data []byte
+	units := 0
+	for _, c := range n.Chunks {
+		data = append(data, c.Data...)
+		units += int(c.Length)
+	}
+	r, err := NewHessian(bytes.NewReader(data)).nextRune(units)
+	return string(r), err
+}
+
+// encodeLong2 encode the compact hessian 2.0 long
+func encodeLong2(v int64) []byte {
+	switch {
+	case v >= -8 && v <= 15:
+		return []byte{byte(0xe0 + v)}
+	case v >= -2048 && v <= 2047:
+		return []byte{byte(0xf8 + v>>8), byte(v)}
+	case v >= -262144 && v <= 262143:
+		return []byte{byte(0x3c + v>>16), byte(v >> 8), byte(v)}
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		b := make([]byte, 5)
+		b[0] = 0x59
+		binary.BigEndian.PutUint32(b[1:], uint32(v))
+		return b
+	}
+	b := make([]byte, 9)
+	b[0] = 'L'
+	binary.BigEndian.PutUint64(b[1:], uint64(v))
+	return b
+}
+
+// encodeDouble2 encode the compact hessian 2.0 double, as java writes it:
+// 0.0, 1.0, a byte, a short, or an int of thousandths
+func encodeDouble2(v float64) []byte {
+	if v != 0 || !math.Signbit(v) { // -0.0 keeps its sign
+		switch {
+		case v == 0:
+			return []byte{0x5b}
+		case v == 1:
+			return []byte{0x5c}
+		case v == math.Trunc(v) && v >= math.MinInt8 && v <= math.MaxInt8:
+			return []byte{0x5d, byte(int8(v))}
+		case v == math.Trunc(v) && v >= math.MinInt16 && v <= math.MaxInt16:
+			return []byte{0x5e, byte(int16(v) >> 8), byte(int16(v))}
+		}
+		if m := v * 1000; m >= math.MinInt32 && m <= math.MaxInt32 && 0.001*float64(int32(m)) == v {
+			b := make([]byte, 5)
+			b[0] = 0x5f
+			binary.BigEndian.PutUint32(b[1:], uint32(int32(m)))
+			return b
+		}
+	}
+	b := make([]byte, 9)
+	b[0] = 'D'
+	binary.BigEndian.PutUint64(b[1:], math.Float64bits(v))
+	return b
+}
+
+// encodeDate2 encode a date of milliseconds since the epoch, in minutes if
+// it is a whole minute
+func encodeDate2(ms int64) []byte {
+	if min := ms / 60000; ms%60000 == 0 && min >= math.MinInt32 && min <= math.MaxInt32 {
+		b := make([]byte, 5)
+		b[0] = 0x4b
+		binary.BigEndian.PutUint32(b[1:], uint32(int32(min)))
+		return b
+	}
+	b := make([]byte, 9)
+	b[0] = 0x4a
+	binary.BigEndian.PutUint64(b[1:], uint64(ms))
+	return b
+}
+
+// encodeBinary2 encode hessian 2.0 binary, chunks but the last are 'A'
+func encodeBinary2(v []byte) (b []byte) {
+	for l := CHUNK_SIZE; len(v) > l; v = v[l:] {
+		b = append(b, 'A', byte(l>>8), byte(l))
+		b = append(b, v[:l]...)
+	}
+	switch l := len(v); {
+	case l <= 15:
+		b = append(b, byte(0x20+l))
+	case l <= 1023:
+		b = append(b, byte(0x34+l>>8), byte(l))
+	default:
+		b = append(b, 'B', byte(l>>8), byte(l))
+	}
+	return append(b, v...)
+}
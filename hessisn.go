@@ -3,6 +3,8 @@ package gohessian
 import (
 	"bufio"
 	"reflect"
+	"sync"
+	"time"
 )
 
 const (
@@ -16,6 +18,21 @@ type Any interface{}
 type Hessian struct {
 	reader *bufio.Reader
 	refs   []Any
+	offset int64 // bytes read
+
+	// TypedValues decode typed lists as TypedList and typed maps of classes
+	// which are not registered as TypedMap, instead of dropping their type
+	TypedValues bool
+
+	// Location of decoded dates and java.time instants, time.Local if nil
+	Location *time.Location
+
+	// Hessian2 decode the hessian 2.0 grammar, it is set when a hessian 2.0
+	// reply 'H' x02 x00 is read
+	Hessian2 bool
+
+	types   []string // hessian 2.0 types of lists and maps
+	classes []class2 // hessian 2.0 class definitions
 }
 
 type Client struct {
@@ -23,4 +40,14 @@ type Client struct {
 	URL       string
 	replyData reflect.Value
 	replyMap  interface{}
+	replyMu   sync.Mutex // guard replyData and replyMap
+
+	interceptors []Interceptor
+	endpoints    []*Endpoint
+	balancer     Balancer
+	health       HealthPolicy
+	breakers     *breakerSet
+	encoding     encodeOptions
+	typedValues  bool
+	location     *time.Location
 }
@@ -0,0 +1,50 @@
+package gohessian
+
+import (
+	"context"
+	"time"
+)
+
+// Invoker performs a hessian call and return the parsed reply
+type Invoker func(ctx context.Context, method string, params []interface{}) (interface{}, error)
+
+// Interceptor wraps a hessian call. It may change method or params before
+// calling next, call next more than once, or replace the reply and error.
+type Interceptor func(ctx context.Context, method string, params []interface{}, next Invoker) (interface{}, error)
+
+// Invocation describe a finished hessian call
+type Invocation struct {
+	Method   string
+	Params   []interface{}
+	Reply    interface{}
+	Err      error
+	Duration time.Duration
+}
+
+// Observe return an interceptor which report every finished call to fn,
+// useful for logging and metrics
+func Observe(fn func(Invocation)) Interceptor {
+	return func(ctx context.Context, method string, params []interface{}, next Invoker) (interface{}, error) {
+		start := time.Now()
+		reply, err := next(ctx, method, params)
+		fn(Invocation{
+			Method:   method,
+			Params:   params,
+			Reply:    reply,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+		return reply, err
+	}
+}
+
+// chain compose interceptors around invoker, the first interceptor is the outermost
+func chain(invoker Invoker, interceptors []Interceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		next, ic := invoker, interceptors[i]
+		invoker = func(ctx context.Context, method string, params []interface{}) (interface{}, error) {
+			return ic(ctx, method, params, next)
+		}
+	}
+	return invoker
+}
@@ -0,0 +1,279 @@
+package gohessian
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// java8Handle is the package of the hessian-lite handles serializing the
+// java.time classes, like LocalDateHandle for java.time.LocalDate
+const java8Handle = "com.alibaba.com.caucho.hessian.io.java8."
+
+// java8HandlePackages are the handle packages of hessian-lite and of the
+// caucho forks decoded as java.time classes
+var java8HandlePackages = []string{java8Handle, "com.caucho.hessian.io.java8."}
+
+// LocalDate is a date without time zone, java.time.LocalDate
+type LocalDate struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// In return the start of the date in loc
+func (d LocalDate) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+func (d LocalDate) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// MarshalHessian encode the date as hessian-lite LocalDateHandle
+func (d LocalDate) MarshalHessian() ([]byte, error) {
+	return encodeClassFields(java8Handle+"LocalDateHandle",
+		"year", int32(d.Year), "month", int32(d.Month), "day", int32(d.Day))
+}
+
+// LocalTime is a time of day without time zone, java.time.LocalTime
+type LocalTime struct {
+	Hour       int
+	Minute     int
+	Second     int
+	Nanosecond int
+}
+
+func (t LocalTime) String() string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if t.Nanosecond != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", t.Nanosecond), "0")
+	}
+	return s
+}
+
+// MarshalHessian encode the time as hessian-lite LocalTimeHandle
+func (t LocalTime) MarshalHessian() ([]byte, error) {
+	return encodeClassFields(java8Handle+"LocalTimeHandle",
+		"hour", int32(t.Hour), "minute", int32(t.Minute), "second", int32(t.Second), "nano", int32(t.Nanosecond))
+}
+
+// LocalDateTime is a date and time without time zone, java.time.LocalDateTime
+type LocalDateTime struct {
+	Date LocalDate
+	Time LocalTime
+}
+
+// In return the date and time in loc
+func (dt LocalDateTime) In(loc *time.Location) time.Time {
+	return time.Date(dt.Date.Year, dt.Date.Month, dt.Date.Day,
+		dt.Time.Hour, dt.Time.Minute, dt.Time.Second, dt.Time.Nanosecond, loc)
+}
+
+func (dt LocalDateTime) String() string {
+	return dt.Date.String() + "T" + dt.Time.String()
+}
+
+// MarshalHessian encode the date and time as hessian-lite LocalDateTimeHandle
+func (dt LocalDateTime) MarshalHessian() ([]byte, error) {
+	return encodeClassFields(java8Handle+"LocalDateTimeHandle", "date", dt.Date, "time", dt.Time)
+}
+
+// LocalDateOf return the date of t
+func LocalDateOf(t time.Time) LocalDate {
+	y, m, d := t.Date()
+	return LocalDate{Year: y, Month: m, Day: d}
+}
+
+// LocalTimeOf return the time of day of t
+func LocalTimeOf(t time.Time) LocalTime {
+	return LocalTime{Hour: t.Hour(), Minute: t.Minute(), Second: t.Second(), Nanosecond: t.Nanosecond()}
+}
+
+// LocalDateTimeOf return the date and time of t
+func LocalDateTimeOf(t time.Time) LocalDateTime {
+	return LocalDateTime{Date: LocalDateOf(t), Time: LocalTimeOf(t)}
+}
+
+// encodeClassFields encode a map of class name with the keys and values in
+// kvs, in order
+func encodeClassFields(name string, kvs ...interface{}) (b []byte, err error) {
+	if b, err = encodeMapHead(name); err != nil {
+		return nil, err
+	}
+	for _, kv := range kvs {
+		tmp, err := Encode(kv)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, tmp...)
+	}
+	return append(b, 'z'), nil
+}
+
+// javaTimeDecoder convert the decoded fields of a java.time class, or of its
+// handle, to its go value, dates in loc
+type javaTimeDecoder func(m map[interface{}]interface{}, loc *time.Location) (interface{}, error)
+
+// javaTimeClasses map the simple names of java.time classes to decoders:
+//	LocalDate      LocalDate
+//	LocalTime      LocalTime
+//	LocalDateTime  LocalDateTime
+//	Instant        time.Time in the decode location
+//	OffsetDateTime time.Time in its offset
+//	ZonedDateTime  time.Time in its zone, or offset if the zone is unknown
+//	ZoneOffset     *time.Location
+//	ZoneId         *time.Location
+//	Duration       time.Duration
+var javaTimeClasses = map[string]javaTimeDecoder{
+	"LocalDate": func(m map[interface{}]interface{}, _ *time.Location) (interface{}, error) {
+		return decodeLocalDate(m)
+	},
+	"LocalTime": func(m map[interface{}]interface{}, _ *time.Location) (interface{}, error) {
+		return decodeLocalTime(m)
+	},
+	"LocalDateTime": func(m map[interface{}]interface{}, _ *time.Location) (interface{}, error) {
+		return decodeLocalDateTime(m)
+	},
+	"Instant": func(m map[interface{}]interface{}, loc *time.Location) (interface{}, error) {
+		f, err := timeFields(m, "seconds", "nanos")
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(f[0], f[1]).In(loc), nil
+	},
+	"OffsetDateTime": decodeZonedDateTime,
+	"ZonedDateTime":  decodeZonedDateTime,
+	"ZoneOffset": func(m map[interface{}]interface{}, _ *time.Location) (interface{}, error) {
+		return decodeZoneOffset(m)
+	},
+	"ZoneId": func(m map[interface{}]interface{}, _ *time.Location) (interface{}, error) {
+		id, _ := m["zoneId"].(string)
+		return time.LoadLocation(id)
+	},
+	"Duration": func(m map[interface{}]interface{}, _ *time.Location) (interface{}, error) {
+		f, err := timeFields(m, "seconds", "nanos")
+		if err != nil {
+			return nil, err
+		}
+		return time.Duration(f[0])*time.Second + time.Duration(f[1]), nil
+	},
+}
+
+// javaTimeClass return the decoder of a java.time class or handle name
+func javaTimeClass(class string) (dec javaTimeDecoder, ok bool) {
+	name := strings.TrimPrefix(class, "java.time.")
+	if name == class {
+		for _, pkg := range java8HandlePackages {
+			if strings.HasPrefix(class, pkg) && strings.HasSuffix(class, "Handle") {
+				name = strings.TrimSuffix(strings.TrimPrefix(class, pkg), "Handle")
+				break
+			}
+		}
+	}
+	if name == class {
+		return nil, false
+	}
+	dec, ok = javaTimeClasses[name]
+	return
+}
+
+// timeFields return the integer fields named keys of m
+func timeFields(m map[interface{}]interface{}, keys ...string) ([]int64, error) {
+	f := make([]int64, len(keys))
+	for i, key := range keys {
+		var err error
+		if f[i], err = ToInt64(m[key]); err != nil {
+			return nil, fmt.Errorf("field %s: %v", key, err)
+		}
+	}
+	return f, nil
+}
+
+func decodeLocalDate(m map[interface{}]interface{}) (d LocalDate, err error) {
+	f, err := timeFields(m, "year", "month", "day")
+	if err != nil {
+		return d, err
+	}
+	return LocalDate{Year: int(f[0]), Month: time.Month(f[1]), Day: int(f[2])}, nil
+}
+
+func decodeLocalTime(m map[interface{}]interface{}) (t LocalTime, err error) {
+	f, err := timeFields(m, "hour", "minute", "second", "nano")
+	if err != nil {
+		return t, err
+	}
+	return LocalTime{Hour: int(f[0]), Minute: int(f[1]), Second: int(f[2]), Nanosecond: int(f[3])}, nil
+}
+
+// decodeLocalDateTime decode the date and time fields, decoded already
+// unless their classes are unknown
+func decodeLocalDateTime(m map[interface{}]interface{}) (dt LocalDateTime, err error) {
+	switch d := m["date"].(type) {
+	case LocalDate:
+		dt.Date = d
+	case map[interface{}]interface{}:
+		if dt.Date, err = decodeLocalDate(d); err != nil {
+			return dt, err
+		}
+	default:
+		return dt, fmt.Errorf("field date: cannot convert %T to LocalDate", d)
+	}
+	switch t := m["time"].(type) {
+	case LocalTime:
+		dt.Time = t
+	case map[interface{}]interface{}:
+		if dt.Time, err = decodeLocalTime(t); err != nil {
+			return dt, err
+		}
+	default:
+		return dt, fmt.Errorf("field time: cannot convert %T to LocalTime", t)
+	}
+	return dt, nil
+}
+
+func decodeZoneOffset(m map[interface{}]interface{}) (*time.Location, error) {
+	key := "seconds"
+	if _, ok := m["totalSeconds"]; ok {
+		key = "totalSeconds" // java serialization of java.time.ZoneOffset
+	}
+	f, err := timeFields(m, key)
+	if err != nil {
+		return nil, err
+	}
+	return time.FixedZone("", int(f[0])), nil
+}
+
+func decodeZonedDateTime(m map[interface{}]interface{}, _ *time.Location) (interface{}, error) {
+	var dt LocalDateTime
+	switch v := m["dateTime"].(type) {
+	case LocalDateTime:
+		dt = v
+	case map[interface{}]interface{}:
+		var err error
+		if dt, err = decodeLocalDateTime(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("field dateTime: cannot convert %T to LocalDateTime", v)
+	}
+
+	var loc *time.Location
+	switch v := m["offset"].(type) {
+	case *time.Location:
+		loc = v
+	case map[interface{}]interface{}:
+		var err error
+		if loc, err = decodeZoneOffset(v); err != nil {
+			return nil, err
+		}
+	default:
+		loc = time.UTC
+	}
+	if id, ok := m["zoneId"].(string); ok {
+		if zone, err := time.LoadLocation(id); err == nil {
+			loc = zone
+		}
+	}
+	return dt.In(loc), nil
+}
@@ -0,0 +1,141 @@
+package gohessian
+
+import (
+	"fmt"
+	"time"
+)
+
+// HessianMarshaler is implemented by types which encode themselves, like
+// encoding/json's Marshaler. The returned bytes must be a complete hessian
+// value. Encode calls it wherever the type appears, in params, fields, list
+// items and map entries, also when it is implemented with a pointer
+// receiver. hessiangen -marshal generates it for structs.
+type HessianMarshaler interface {
+	MarshalHessian() ([]byte, error)
+}
+
+// HessianWriter is implemented by marshalers which write themselves to an
+// Encoder. Encode calls it instead of MarshalHessian with an encoder having
+// the options of the value holding it, like SetDeterministic and SetStrict.
+// hessiangen -marshal generates it for structs.
+type HessianWriter interface {
+	WriteHessian(e *Encoder) error
+}
+
+// HessianUnmarshaler is implemented by types which bind themselves from a
+// value decoded by Parse. Bind and BindResult call it wherever the type
+// appears in the target, and return the first error it returns.
+type HessianUnmarshaler interface {
+	UnmarshalHessian(v interface{}) error
+}
+
+// ToBool convert a decoded value to bool, nil gives false
+func ToBool(v interface{}) (bool, error) {
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("cannot convert %T to bool", v)
+}
+
+// ToInt32 convert a decoded value to int32, nil gives 0
+func ToInt32(v interface{}) (int32, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case int32:
+		return v, nil
+	case int64:
+		if v >= -2147483648 && v <= 2147483647 {
+			return int32(v), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert %T %v to int32", v, v)
+}
+
+// ToInt64 convert a decoded value to int64, nil gives 0
+func ToInt64(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to int64", v)
+}
+
+// ToFloat64 convert a decoded value to float64, nil gives 0
+func ToFloat64(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to float64", v)
+}
+
+// ToString convert a decoded value to string, nil gives ""
+func ToString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("cannot convert %T to string", v)
+}
+
+// ToTime convert a decoded value to time.Time, nil gives the zero time
+func ToTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to time.Time", v)
+}
+
+// ToBytes convert a decoded value to []byte, nil gives nil
+func ToBytes(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to []byte", v)
+}
+
+// ToMap convert a decoded map to its entries, also a TypedMap or a reference
+// to a map, nil gives nil
+func ToMap(v interface{}) (map[interface{}]interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case map[interface{}]interface{}:
+		return v, nil
+	case *map[interface{}]interface{}:
+		if v != nil {
+			return *v, nil
+		}
+		return nil, nil
+	case TypedMap:
+		return v.Entries, nil
+	case *interface{}:
+		if v != nil {
+			return ToMap(*v)
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to map", v)
+}
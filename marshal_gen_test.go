@@ -0,0 +1,240 @@
+// Code generated by hessiangen; DO NOT EDIT.
+
+package gohessian_test
+
+import (
+	"bytes"
+
+	gohessian "github.com/MenInBack/gohessian"
+)
+
+// MarshalHessian encode genOrder as a map of its registered class or
+// com.acme.Order without reflection
+func (v genOrder) MarshalHessian() ([]byte, error) {
+	var b bytes.Buffer
+	if err := v.WriteHessian(gohessian.NewEncoder(&b)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteHessian write genOrder to e, with the options of e, without reflection
+func (v genOrder) WriteHessian(e *gohessian.Encoder) error {
+	e.WriteMapBegin(gohessian.ClassName(v, "com.acme.Order"))
+	e.WriteString("id")
+	e.WriteInt64(v.ID)
+	e.WriteString("title")
+	e.WriteString(v.Title)
+	e.WriteString("amount")
+	e.WriteFloat64(v.Amount)
+	e.WriteString("paid")
+	e.WriteBool(v.Paid)
+	e.WriteString("created")
+	e.WriteTime(v.Created)
+	e.WriteString("tags")
+	e.Encode(v.Tags)
+	e.WriteMapEnd()
+	return e.Err()
+}
+
+// UnmarshalHessian bind a decoded map to genOrder without reflection, a
+// genOrder decoded as a registered type is copied
+func (v *genOrder) UnmarshalHessian(data interface{}) (err error) {
+	switch d := data.(type) {
+	case genOrder:
+		*v = d
+		return nil
+	case *genOrder:
+		if d != nil {
+			*v = *d
+		}
+		return nil
+	}
+	m, err := gohessian.ToMap(data)
+	if err != nil {
+		return err
+	}
+	for k, x := range m {
+		switch k {
+		case "id", "ID":
+			v.ID, err = gohessian.ToInt64(x)
+		case "title", "Title":
+			v.Title, err = gohessian.ToString(x)
+		case "amount", "Amount":
+			v.Amount, err = gohessian.ToFloat64(x)
+		case "paid", "Paid":
+			v.Paid, err = gohessian.ToBool(x)
+		case "created", "Created":
+			v.Created, err = gohessian.ToTime(x)
+		case "tags", "Tags":
+			err = gohessian.Bind(x, &v.Tags)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalHessian encode regOrder as a map of its registered class or
+// gohessian.test.RegOrder without reflection
+func (v regOrder) MarshalHessian() ([]byte, error) {
+	var b bytes.Buffer
+	if err := v.WriteHessian(gohessian.NewEncoder(&b)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteHessian write regOrder to e, with the options of e, without reflection
+func (v regOrder) WriteHessian(e *gohessian.Encoder) error {
+	e.WriteMapBegin(gohessian.ClassName(v, "gohessian.test.RegOrder"))
+	e.WriteString("id")
+	e.WriteInt64(v.ID)
+	e.WriteString("title")
+	e.WriteString(v.Title)
+	e.WriteMapEnd()
+	return e.Err()
+}
+
+// UnmarshalHessian bind a decoded map to regOrder without reflection, a
+// regOrder decoded as a registered type is copied
+func (v *regOrder) UnmarshalHessian(data interface{}) (err error) {
+	switch d := data.(type) {
+	case regOrder:
+		*v = d
+		return nil
+	case *regOrder:
+		if d != nil {
+			*v = *d
+		}
+		return nil
+	}
+	m, err := gohessian.ToMap(data)
+	if err != nil {
+		return err
+	}
+	for k, x := range m {
+		switch k {
+		case "id", "ID":
+			v.ID, err = gohessian.ToInt64(x)
+		case "title", "Title":
+			v.Title, err = gohessian.ToString(x)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalHessian encode optOrder as a map of its registered class or
+// com.acme.OptOrder without reflection
+func (v optOrder) MarshalHessian() ([]byte, error) {
+	var b bytes.Buffer
+	if err := v.WriteHessian(gohessian.NewEncoder(&b)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteHessian write optOrder to e, with the options of e, without reflection
+func (v optOrder) WriteHessian(e *gohessian.Encoder) error {
+	e.WriteMapBegin(gohessian.ClassName(v, "com.acme.OptOrder"))
+	e.WriteField("id", v.ID, "long")
+	if v.Note != "" {
+		e.WriteString("note")
+		e.WriteString(v.Note)
+	}
+	e.WriteField("items", v.Items, "omitempty,list=java.util.ArrayList")
+	e.WriteField("extra", v.Extra, "omitempty")
+	e.WriteMapEnd()
+	return e.Err()
+}
+
+// UnmarshalHessian bind a decoded map to optOrder without reflection, a
+// optOrder decoded as a registered type is copied
+func (v *optOrder) UnmarshalHessian(data interface{}) (err error) {
+	switch d := data.(type) {
+	case optOrder:
+		*v = d
+		return nil
+	case *optOrder:
+		if d != nil {
+			*v = *d
+		}
+		return nil
+	}
+	m, err := gohessian.ToMap(data)
+	if err != nil {
+		return err
+	}
+	for k, x := range m {
+		switch k {
+		case "id", "ID":
+			err = gohessian.Bind(x, &v.ID)
+		case "note", "Note":
+			v.Note, err = gohessian.ToString(x)
+		case "items", "Items":
+			err = gohessian.Bind(x, &v.Items)
+		case "extra", "Extra":
+			err = gohessian.Bind(x, &v.Extra)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalHessian encode renamedOrder as a map of its registered class or
+// com.acme.RenamedOrder without reflection
+func (v renamedOrder) MarshalHessian() ([]byte, error) {
+	var b bytes.Buffer
+	if err := v.WriteHessian(gohessian.NewEncoder(&b)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteHessian write renamedOrder to e, with the options of e, without reflection
+func (v renamedOrder) WriteHessian(e *gohessian.Encoder) error {
+	e.WriteMapBegin(gohessian.ClassName(v, "com.acme.RenamedOrder"))
+	e.WriteString("id")
+	e.WriteInt64(v.ID)
+	e.WriteString("title")
+	e.WriteString(v.Title)
+	e.WriteMapEnd()
+	return e.Err()
+}
+
+// UnmarshalHessian bind a decoded map to renamedOrder without reflection, a
+// renamedOrder decoded as a registered type is copied
+func (v *renamedOrder) UnmarshalHessian(data interface{}) (err error) {
+	switch d := data.(type) {
+	case renamedOrder:
+		*v = d
+		return nil
+	case *renamedOrder:
+		if d != nil {
+			*v = *d
+		}
+		return nil
+	}
+	m, err := gohessian.ToMap(data)
+	if err != nil {
+		return err
+	}
+	for k, x := range m {
+		switch k {
+		case "id", "ID":
+			v.ID, err = gohessian.ToInt64(x)
+		case "title", "Title":
+			v.Title, err = gohessian.ToString(x)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
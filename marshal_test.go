@@ -0,0 +1,337 @@
+package gohessian_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	gohessian "github.com/MenInBack/gohessian"
+)
+
+//go:generate hessiangen -marshal -type genOrder,regOrder,optOrder,renamedOrder -output marshal_gen_test.go
+
+// genOrder has generated marshalers in marshal_gen_test.go
+type genOrder struct {
+	Name    gohessian.HessianName `hs:"com.acme.Order"`
+	ID      int64                 `hs:"id"`
+	Title   string                `hs:"title"`
+	Amount  float64               `hs:"amount"`
+	Paid    bool                  `hs:"paid"`
+	Created time.Time             `hs:"created"`
+	Tags    []string              `hs:"tags"`
+}
+
+// regOrder has generated marshalers and is registered, under a test only
+// class name as the registry is global
+type regOrder struct {
+	Name  gohessian.HessianName `hs:"gohessian.test.RegOrder"`
+	ID    int64                 `hs:"id"`
+	Title string                `hs:"title"`
+}
+
+// optOrder has generated marshalers and tag options
+type optOrder struct {
+	Name  gohessian.HessianName `hs:"com.acme.OptOrder"`
+	ID    int32                 `hs:"id,long"`
+	Note  string                `hs:"note,omitempty"`
+	Items []string              `hs:"items,omitempty,list=java.util.ArrayList"`
+	Extra map[string]int32      `hs:"extra,omitempty"`
+}
+
+// renamedOrder has generated marshalers and is registered under another
+// class name than its tag
+type renamedOrder struct {
+	Name  gohessian.HessianName `hs:"com.acme.RenamedOrder"`
+	ID    int64                 `hs:"id"`
+	Title string                `hs:"title"`
+}
+
+// reflectRenamedOrder is renamedOrder encoded by reflection, with the
+// registered name
+type reflectRenamedOrder struct {
+	Name  gohessian.HessianName `hs:"gohessian.test.RenamedOrder"`
+	ID    int64                 `hs:"id"`
+	Title string                `hs:"title"`
+}
+
+// reflectOptOrder is optOrder encoded by reflection
+type reflectOptOrder struct {
+	Name  gohessian.HessianName `hs:"com.acme.OptOrder"`
+	ID    int32                 `hs:"id,long"`
+	Note  string                `hs:"note,omitempty"`
+	Items []string              `hs:"items,omitempty,list=java.util.ArrayList"`
+	Extra map[string]int32      `hs:"extra,omitempty"`
+}
+
+// reflectOrder is genOrder encoded by reflection
+type reflectOrder struct {
+	Name    gohessian.HessianName `hs:"com.acme.Order"`
+	ID      int64                 `hs:"id"`
+	Title   string                `hs:"title"`
+	Amount  float64               `hs:"amount"`
+	Paid    bool                  `hs:"paid"`
+	Created time.Time             `hs:"created"`
+	Tags    []string              `hs:"tags"`
+}
+
+var benchCreated = time.Unix(1390730601, 0)
+
+func newGenOrder() genOrder {
+	return genOrder{ID: 19890604, Title: "兔兔", Amount: 10.5, Paid: true, Created: benchCreated, Tags: []string{"a", "b"}}
+}
+
+func newReflectOrder() reflectOrder {
+	return reflectOrder(newGenOrder())
+}
+
+func Test_generated_marshaler(t *testing.T) {
+	want, err := gohessian.Encode(newReflectOrder())
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	got, err := gohessian.Encode(newGenOrder())
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Fatalf("want %v , got %v", want, got)
+	}
+
+	reply, err := gohessian.NewHessian(bytes.NewReader(got)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	var o genOrder
+	if err = gohessian.Bind(reply, &o); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if o.ID != 19890604 || o.Title != "兔兔" || !o.Paid || !o.Created.Equal(benchCreated) || len(o.Tags) != 2 {
+		t.Fatalf("unexpected order %+v", o)
+	}
+}
+
+func Test_generated_unmarshaler_values(t *testing.T) {
+	b, err := gohessian.Encode(newGenOrder())
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	h := gohessian.NewHessian(bytes.NewReader(b))
+	h.TypedValues = true
+	typed, err := h.Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	entries := typed.(gohessian.TypedMap).Entries
+	o := newGenOrder()
+	var ref interface{} = entries
+	for _, reply := range []interface{}{typed, &entries, &ref, o, &o} {
+		var got genOrder
+		if err = gohessian.Bind(reply, &got); err != nil {
+			t.Fatalf("bind %T: %v", reply, err)
+		}
+		if got.ID != o.ID || got.Title != o.Title || len(got.Tags) != 2 {
+			t.Fatalf("bind %T: unexpected order %+v", reply, got)
+		}
+	}
+}
+
+func Test_generated_unmarshaler_registered(t *testing.T) {
+	gohessian.RegisterType("gohessian.test.RegOrder", regOrder{})
+	o := regOrder{ID: 7, Title: "x"}
+	b, err := gohessian.Encode([]interface{}{o, &o})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	reply, err := gohessian.NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if items := reply.([]interface{}); items[0] != o {
+		t.Fatalf("want %+v decoded as registered type, got %#v", o, items[0])
+	}
+	var got []*regOrder
+	if err = gohessian.Bind(reply, &got); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if len(got) != 2 || *got[0] != o || *got[1] != o {
+		t.Fatalf("want %+v, got %+v", o, got)
+	}
+}
+
+func Test_generated_marshaler_registered_name(t *testing.T) {
+	gohessian.RegisterType("gohessian.test.RenamedOrder", renamedOrder{})
+	o := renamedOrder{ID: 7, Title: "x"}
+	want, err := gohessian.Encode(reflectRenamedOrder(o))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	for _, v := range []interface{}{o, &o} {
+		got, err := gohessian.Encode(v)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Fatalf("want %q , got %q", want, got)
+		}
+	}
+}
+
+func Test_generated_marshaler_tag_options(t *testing.T) {
+	for _, o := range []optOrder{{ID: 1}, {ID: 2, Note: "n", Items: []string{"a"}, Extra: map[string]int32{"x": 1}}} {
+		want, err := gohessian.Encode(reflectOptOrder(o))
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		got, err := gohessian.Encode(o)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Fatalf("want %q , got %q", want, got)
+		}
+		reply, err := gohessian.NewHessian(bytes.NewReader(got)).Parse()
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		var back optOrder
+		if err = gohessian.Bind(reply, &back); err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		if back.ID != o.ID || back.Note != o.Note || len(back.Items) != len(o.Items) || len(back.Extra) != len(o.Extra) {
+			t.Fatalf("want %+v, got %+v", o, back)
+		}
+	}
+}
+
+func Test_generated_marshaler_encoder_options(t *testing.T) {
+	o := optOrder{ID: 1, Extra: map[string]int32{}}
+	for i := int32(0); i < 16; i++ {
+		o.Extra[fmt.Sprint("k", i)] = i
+	}
+	encode := func(v interface{}) []byte {
+		var b bytes.Buffer
+		e := gohessian.NewEncoder(&b)
+		e.SetDeterministic(true)
+		if err := e.Encode([]interface{}{v}); err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		return b.Bytes()
+	}
+	want := encode(reflectOptOrder(o))
+	for i := 0; i < 10; i++ {
+		if got := encode(o); !bytes.Equal(want, got) {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func Benchmark_encode_reflect(b *testing.B) {
+	o := newReflectOrder()
+	for i := 0; i < b.N; i++ {
+		gohessian.Encode(o)
+	}
+}
+
+func Benchmark_encode_generated(b *testing.B) {
+	o := newGenOrder()
+	for i := 0; i < b.N; i++ {
+		gohessian.Encode(o)
+	}
+}
+
+func benchmarkBind(b *testing.B, v interface{}) {
+	data, _ := gohessian.Encode(newReflectOrder())
+	reply, _ := gohessian.NewHessian(bytes.NewReader(data)).Parse()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gohessian.Bind(reply, v)
+	}
+}
+
+func Benchmark_bind_reflect(b *testing.B) {
+	benchmarkBind(b, &reflectOrder{})
+}
+
+func Benchmark_bind_generated(b *testing.B) {
+	benchmarkBind(b, &genOrder{})
+}
+
+// money is encoded as a java object holding its amount in cents
+type money int64
+
+func (m *money) MarshalHessian() ([]byte, error) {
+	var b bytes.Buffer
+	e := gohessian.NewEncoder(&b)
+	e.WriteMapBegin("com.acme.Money")
+	e.WriteString("cents")
+	e.WriteInt64(int64(*m))
+	e.WriteMapEnd()
+	return b.Bytes(), e.Err()
+}
+
+func (m *money) UnmarshalHessian(v interface{}) error {
+	data, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return fmt.Errorf("cannot bind %T to money", v)
+	}
+	cents, err := gohessian.ToInt64(data["cents"])
+	*m = money(cents)
+	return err
+}
+
+// uuid is encoded as its string form
+type uuid [4]byte
+
+func (u uuid) MarshalHessian() ([]byte, error) {
+	var b bytes.Buffer
+	e := gohessian.NewEncoder(&b)
+	e.WriteString(hex.EncodeToString(u[:]))
+	return b.Bytes(), e.Err()
+}
+
+func (u *uuid) UnmarshalHessian(v interface{}) error {
+	s, err := gohessian.ToString(v)
+	if err != nil {
+		return err
+	}
+	_, err = hex.Decode(u[:], []byte(s))
+	return err
+}
+
+type payment struct {
+	ID     uuid
+	Amount money
+	Fees   []money
+	Refund *money
+}
+
+func Test_custom_marshaler(t *testing.T) {
+	refund := money(100)
+	p := payment{ID: uuid{1, 2, 3, 4}, Amount: 1050, Fees: []money{1, 2}, Refund: &refund}
+	b, err := gohessian.Encode(p)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if !bytes.Contains(b, []byte("01020304")) || !bytes.Contains(b, []byte("com.acme.Money")) {
+		t.Fatalf("custom encoding not used: %q", b)
+	}
+
+	reply, err := gohessian.NewHessian(bytes.NewReader(b)).Parse()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	var got payment
+	if err = gohessian.Bind(reply, &got); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if got.ID != p.ID || got.Amount != 1050 || len(got.Fees) != 2 || got.Fees[1] != 2 || *got.Refund != 100 {
+		t.Fatalf("want %+v, got %+v", p, got)
+	}
+
+	bad := map[interface{}]interface{}{"ID": "not hex"}
+	if err = gohessian.Bind(bad, &got); err == nil {
+		t.Fatalf("want error of UnmarshalHessian")
+	}
+}
@@ -0,0 +1,334 @@
+package gohessian
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Node is a lossless representation of a hessian value. Hessian.Decode
+// produces it and Encode writes it back as the same bytes, keeping type
+// names, int and long, null, string and binary chunks and references as
+// they were received, which a gateway needs to forward replies.
+type Node struct {
+	// Tag is the wire tag of the value: 'N', 'T', 'F', 'I', 'L', 'D', 'd',
+	// 'S', 'X', 'B', 'V', 'M', 'R', and 'r' for a reply, 'f' for a fault
+	Tag byte
+	// Value is the int32 of 'I', the int64 of 'L', the float64 of 'D', the
+	// milliseconds int64 of 'd', the int32 index of 'R' and the version
+	// []byte{major, minor} of 'r'
+	Value interface{}
+	// Chunks of 'S', 'X' and 'B', all chunks but the last are written with
+	// the lower case tag
+	Chunks []Chunk
+	// Type of 'V' and 'M', empty when not typed
+	Type string
+	// Length of 'V', -1 when not given
+	Length int
+	// Items of 'V', keys and values in turn of 'M' and 'f', body of 'r'
+	Items []Node
+	// Closed tells whether 'r' is terminated by 'z'
+	Closed bool
+}
+
+// Chunk is a chunk of a string or binary as received, Length counts utf-16
+// code units for strings and bytes for binary
+type Chunk struct {
+	Length uint16
+	Data   []byte
+}
+
+// Decode read the next value as a Node. io.EOF is returned when there is no
+// more value, a short read, invalid data or hessian 2.0 data is returned as
+// *DecodeError.
+func (h *Hessian) Decode() (n Node, err error) {
+	if n.Tag, err = h.readByte(); err == io.EOF {
+		return
+	}
+	if err != nil {
+		return n, h.fail(0, err)
+	}
+	tag := n.Tag
+	if h.Hessian2 || tag == 'H' {
+		return n, &DecodeError{Offset: h.offset - 1, Tag: tag, Err: errors.New("hessian 2.0 is not supported, use Parse")}
+	}
+	if err = h.decode(&n); err != nil {
+		err = h.fail(tag, err)
+	}
+	return
+}
+
+// decodeItem decode a value inside the value of tag, which can't end before it
+func (h *Hessian) decodeItem(tag byte) (Node, error) {
+	n, err := h.Decode()
+	if err == io.EOF {
+		err = h.fail(tag, err)
+	}
+	return n, err
+}
+
+// decode the value of n.Tag into n
+func (h *Hessian) decode(n *Node) (err error) {
+	var b []byte
+	switch n.Tag {
+	case 'N', 'T', 'F':
+
+	case 'I', 'R':
+		if b, err = h.next(4); err == nil {
+			n.Value, err = UnpackInt32(b)
+		}
+
+	case 'L', 'd':
+		if b, err = h.next(8); err == nil {
+			n.Value, err = UnpackInt64(b)
+		}
+
+	case 'D':
+		if b, err = h.next(8); err == nil {
+			n.Value, err = UnpackFloat64(b)
+		}
+
+	case 'S', 's', 'X', 'x', 'B', 'b':
+		n.Chunks, err = h.decodeChunks(n.Tag)
+		n.Tag &^= 'a' - 'A' // upper case final tag
+
+	case 'V':
+		if n.Type, err = h.readType(); err != nil {
+			return
+		}
+		n.Length = -1
+		var ok bool
+		if ok, err = h.peekIs('l'); ok {
+			h.discard(1)
+			var l int32
+			if b, err = h.next(4); err != nil {
+				return
+			}
+			if l, err = UnpackInt32(b); err != nil {
+				return
+			}
+			n.Length = int(l)
+		}
+		if err != nil {
+			return
+		}
+		n.Items, err = h.decodeUntilEnd(n.Tag)
+
+	case 'M':
+		if n.Type, err = h.readType(); err != nil {
+			return
+		}
+		n.Items, err = h.decodeUntilEnd(n.Tag)
+
+	case 'r':
+		if n.Value, err = h.next(2); err != nil {
+			return
+		}
+		var body Node
+		if body, err = h.decodeItem(n.Tag); err != nil {
+			return
+		}
+		n.Items = []Node{body}
+		if n.Closed, err = h.peekIs('z'); n.Closed {
+			h.discard(1)
+		}
+
+	case 'f':
+		for {
+			p, err := h.reader.Peek(1)
+			if err == io.EOF || err == nil && p[0] == 'z' {
+				return nil // the end of the fault or of the reply
+			}
+			if err != nil {
+				return err
+			}
+			item, err := h.decodeItem(n.Tag)
+			if err != nil {
+				return err
+			}
+			n.Items = append(n.Items, item)
+		}
+
+	default:
+		err = &DecodeError{Offset: h.offset - 1, Tag: n.Tag, Err: errors.New("invalid tag")}
+	}
+	return
+}
+
+// decodeChunks read the chunks of a string or binary starting with tag
+func (h *Hessian) decodeChunks(tag byte) (chunks []Chunk, err error) {
+	for {
+		c := Chunk{}
+		var l int
+		if l, err = h.nextLength(); err != nil {
+			return
+		}
+		c.Length = uint16(l)
+		if tag == 'B' || tag == 'b' {
+			c.Data, err = h.next(l)
+		} else {
+			c.Data, err = h.runeBytes(l)
+		}
+		if err != nil {
+			return
+		}
+		chunks = append(chunks, c)
+		if tag == 'S' || tag == 'X' || tag == 'B' {
+			return
+		}
+		if tag, err = h.nextChunk(tag); err != nil {
+			return
+		}
+	}
+}
+
+// runeBytes read n utf-16 code units and return their bytes as received
+func (h *Hessian) runeBytes(n int) (b []byte, err error) {
+	for i := 0; i < n; {
+		_, size, units, err := h.peekChar()
+		if err != nil {
+			return b, err
+		}
+		c, err := h.next(size)
+		if err != nil {
+			return b, err
+		}
+		b = append(b, c...)
+		i += units
+	}
+	return
+}
+
+// decodeUntilEnd read nodes of the value of tag until 'z' and consume it
+func (h *Hessian) decodeUntilEnd(tag byte) (items []Node, err error) {
+	for {
+		var next byte
+		if next, err = h.peekByte(); err != nil {
+			return
+		}
+		if next == 'z' {
+			h.discard(1)
+			return
+		}
+		var item Node
+		if item, err = h.decodeItem(tag); err != nil {
+			return
+		}
+		items = append(items, item)
+	}
+}
+
+// MarshalHessian write the node back as it was decoded
+func (n Node) MarshalHessian() (b []byte, err error) {
+	var tmp []byte
+	switch n.Tag {
+	case 'N', 'T', 'F':
+		b = append(b, n.Tag)
+
+	case 'I', 'R':
+		v, ok := n.Value.(int32)
+		if !ok {
+			return nil, fmt.Errorf("node %c: want int32 value, got %T", n.Tag, n.Value)
+		}
+		if tmp, err = PackInt32(v); err != nil {
+			return nil, err
+		}
+		b = append(append(b, n.Tag), tmp...)
+
+	case 'L', 'd':
+		v, ok := n.Value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("node %c: want int64 value, got %T", n.Tag, n.Value)
+		}
+		if tmp, err = PackInt64(v); err != nil {
+			return nil, err
+		}
+		b = append(append(b, n.Tag), tmp...)
+
+	case 'D':
+		v, ok := n.Value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("node %c: want float64 value, got %T", n.Tag, n.Value)
+		}
+		if tmp, err = PackFloat64(v); err != nil {
+			return nil, err
+		}
+		b = append(append(b, n.Tag), tmp...)
+
+	case 'S', 'X', 'B':
+		for i, c := range n.Chunks {
+			tag := n.Tag
+			if i < len(n.Chunks)-1 {
+				tag += 'a' - 'A'
+			}
+			if tmp, err = PackUint16(c.Length); err != nil {
+				return nil, err
+			}
+			b = append(append(b, tag), tmp...)
+			b = append(b, c.Data...)
+		}
+
+	case 'V':
+		b = append(b, 'V')
+		if n.Type != "" {
+			if tmp, err = encodeType(n.Type); err != nil {
+				return nil, err
+			}
+			b = append(b, tmp...)
+		}
+		if n.Length >= 0 {
+			if tmp, err = PackInt32(int32(n.Length)); err != nil {
+				return nil, err
+			}
+			b = append(append(b, 'l'), tmp...)
+		}
+		if b, err = n.appendItems(b); err != nil {
+			return nil, err
+		}
+		b = append(b, 'z')
+
+	case 'M':
+		if b, err = encodeMapHead(n.Type); err != nil {
+			return nil, err
+		}
+		if b, err = n.appendItems(b); err != nil {
+			return nil, err
+		}
+		b = append(b, 'z')
+
+	case 'r':
+		v, ok := n.Value.([]byte)
+		if !ok || len(v) != 2 {
+			return nil, fmt.Errorf("node r: want version []byte{major, minor}, got %v", n.Value)
+		}
+		b = append(append(b, 'r'), v...)
+		if b, err = n.appendItems(b); err != nil {
+			return nil, err
+		}
+		if n.Closed {
+			b = append(b, 'z')
+		}
+
+	case 'f':
+		b = append(b, 'f')
+		if b, err = n.appendItems(b); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("node: invalid tag %q", n.Tag)
+	}
+	return b, nil
+}
+
+// appendItems append the encoding of the items of n to b
+func (n Node) appendItems(b []byte) ([]byte, error) {
+	for _, item := range n.Items {
+		tmp, err := item.MarshalHessian()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, tmp...)
+	}
+	return b, nil
+}
@@ -0,0 +1,148 @@
+package gohessian
+
+import (
+	"reflect"
+	"sync"
+)
+
+// registry map java class names to go types
+var registry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type // by java name
+	names map[reflect.Type]string // by go struct type
+	elems map[string]reflect.Type // list element types by java name
+	lists map[reflect.Type]string // list java names by element type
+}{
+	types: make(map[string]reflect.Type),
+	names: make(map[reflect.Type]string),
+	elems: make(map[string]reflect.Type),
+	lists: make(map[reflect.Type]string),
+}
+
+// RegisterType map the java class name to the go type of v. Typed maps of
+// that class in replies are decoded as values of the type, so they keep
+// their type inside interface{} fields and lists. Values of the type are
+// encoded with that class name. Register a pointer, like &Order{}, to decode
+// the class as pointers. Named map types can be registered as java map
+// classes, like java.util.TreeMap.
+func RegisterType(name string, v interface{}) {
+	t := reflect.TypeOf(v)
+	registry.Lock()
+	defer registry.Unlock()
+	registry.types[name] = t
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	registry.names[t] = name
+}
+
+// RegisterListType map the java list type name to lists of elements of the
+// go type of elem. Slices and arrays of that type are encoded with the name,
+// like "[com.acme.Order" for Order[] or "java.util.ArrayList", and lists of
+// that name in replies are decoded as slices of the type.
+func RegisterListType(name string, elem interface{}) {
+	t := reflect.TypeOf(elem)
+	registry.Lock()
+	defer registry.Unlock()
+	registry.elems[name] = t
+	registry.lists[t] = name
+}
+
+// ClassName return the java class name registered for the type of v, or
+// name if none, so that generated marshalers encode with RegisterType names
+func ClassName(v interface{}, name string) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return name
+	}
+	if registered, ok := registeredName(t); ok {
+		return registered
+	}
+	return name
+}
+
+// unregisterType remove the go type registered for the java class name
+func unregisterType(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+	t, ok := registry.types[name]
+	if !ok {
+		return
+	}
+	delete(registry.types, name)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if registry.names[t] == name {
+		delete(registry.names, t)
+	}
+}
+
+// unregisterListType remove the element type registered for the java list
+// name
+func unregisterListType(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+	t, ok := registry.elems[name]
+	if !ok {
+		return
+	}
+	delete(registry.elems, name)
+	if registry.lists[t] == name {
+		delete(registry.lists, t)
+	}
+}
+
+// registeredListName return the java list name registered for the element type
+func registeredListName(elem reflect.Type) (name string, ok bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	name, ok = registry.lists[elem]
+	return
+}
+
+// registeredElem return the element type registered for the java list name
+func registeredElem(name string) (t reflect.Type, ok bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok = registry.elems[name]
+	return
+}
+
+// registeredType return the go type registered for the java class name
+func registeredType(name string) (t reflect.Type, ok bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok = registry.types[name]
+	return
+}
+
+// registeredName return the java class name registered for the go type
+func registeredName(t reflect.Type) (name string, ok bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	name, ok = registry.names[t]
+	return
+}
+
+// instantiate bind a decoded map of a registered class to its go type
+func instantiate(data map[interface{}]interface{}, t reflect.Type) (interface{}, error) {
+	v, err := extractData(reflect.ValueOf(data), t)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// instantiateList bind a decoded list of a registered name to a slice of its
+// element type
+func instantiateList(data []interface{}, elem reflect.Type) (interface{}, error) {
+	v, err := extractData(reflect.ValueOf(data), reflect.SliceOf(elem))
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
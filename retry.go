@@ -0,0 +1,84 @@
+package gohessian
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describe how a failed call is retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one,
+	// a value less than 2 disables retry
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts, zero means no cap
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every retry, defaults to 2
+	Multiplier float64
+	// Jitter is the fraction in [0, 1] of every backoff which is randomised
+	Jitter float64
+	// Idempotent lists the methods which are safe to call more than once,
+	// other methods are never retried, nor calls with io.Reader params
+	// which are drained by the first attempt
+	Idempotent []string
+	// Classify categorise errors, defaults to Classify. Only ClassTransport
+	// errors are retried, so faults replied by the service never are.
+	Classify func(err error) ErrorClass
+}
+
+// WithRetry retry idempotent calls of the client according to p
+func WithRetry(p RetryPolicy) Option {
+	return WithInterceptors(Retry(p))
+}
+
+// Retry return an interceptor which retry calls according to p
+func Retry(p RetryPolicy) Interceptor {
+	idempotent := make(map[string]bool, len(p.Idempotent))
+	for _, m := range p.Idempotent {
+		idempotent[m] = true
+	}
+	classify := p.Classify
+	if classify == nil {
+		classify = Classify
+	}
+
+	return func(ctx context.Context, method string, params []interface{}, next Invoker) (interface{}, error) {
+		if !idempotent[method] || hasReader(params) {
+			return next(ctx, method, params)
+		}
+		for attempt := 1; ; attempt++ {
+			reply, err := next(ctx, method, params)
+			if err == nil || attempt >= p.MaxAttempts || classify(err) != ClassTransport {
+				return reply, err
+			}
+			timer := time.NewTimer(p.backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// backoff return the wait after the given failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
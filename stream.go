@@ -0,0 +1,235 @@
+package gohessian
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+// WriteBinaryFrom write the content of r as binary, chunk by chunk, so that
+// large content is not held in memory
+func (e *Encoder) WriteBinaryFrom(r io.Reader) {
+	buf := make([]byte, CHUNK_SIZE)
+	for e.err == nil {
+		n, err := io.ReadFull(r, buf)
+		tag := byte('b')
+		if e.opts.hessian2 {
+			tag = 'A'
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			tag = 'B' // the final chunk may be empty
+		default:
+			e.err = err
+			return
+		}
+		l, _ := PackUint16(uint16(n))
+		e.write(append([]byte{tag}, l...), nil)
+		e.write(buf[:n], nil)
+		if tag == 'B' {
+			return
+		}
+	}
+}
+
+// encodeReader encode the content of r as binary, in memory
+func encodeReader(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return encodeBinary(b)
+}
+
+// hasReader tell whether params has an io.Reader to stream
+func hasReader(params []interface{}) bool {
+	for _, p := range params {
+		if _, ok := streamedReader(p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// streamedReader return v as a reader streamed as binary, custom encodings
+// take precedence
+func streamedReader(v interface{}) (io.Reader, bool) {
+	if v != nil && isMarshaler(reflect.TypeOf(v)) {
+		return nil, false
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, false
+	}
+	r, ok := v.(io.Reader)
+	return r, ok
+}
+
+// requestBody return the request calling method with params. io.Reader
+// params are streamed as binary through a pipe, which the caller must close,
+// the error of a streamed param is then returned by the request.
+func (c *Client) requestBody(method string, params []interface{}) (io.Reader, error) {
+	r := &hessianRequest{opts: c.encoding}
+	r.packHead(method, len(params))
+	if !hasReader(params) {
+		for _, v := range params {
+			if err := r.packParam(v); err != nil {
+				return nil, err
+			}
+		}
+		r.packEnd()
+		return bytes.NewReader(r.body), nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		e := NewEncoder(pw)
+		e.opts = c.encoding
+		e.write(r.body, nil)
+		for _, v := range params {
+			e.Encode(v)
+		}
+		e.write(r.end(), nil)
+		pw.CloseWithError(e.Err())
+	}()
+	return pr, nil
+}
+
+// InvokeReader call method and return its binary reply as a stream, which
+// is read from the response as it arrives. The caller must close it. A null
+// reply is empty. Params which are io.Reader are streamed too, such calls
+// are sent to a single endpoint and are not retried.
+func (c *Client) InvokeReader(ctx context.Context, method string, params ...interface{}) (io.ReadCloser, error) {
+	reply, err := chain(c.invokeReader, c.interceptors)(ctx, method, params)
+	if err != nil {
+		return nil, err
+	}
+	rc, ok := reply.(io.ReadCloser)
+	if !ok {
+		return nil, fmt.Errorf("reply of %s is %T, not a stream", method, reply)
+	}
+	return rc, nil
+}
+
+// invokeReader post the request and return the binary reply as a stream
+func (c *Client) invokeReader(ctx context.Context, method string, params []interface{}) (interface{}, error) {
+	body, err := c.requestBody(method, params)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := c.post(ctx, method, body, false)
+	if err != nil {
+		closeBody(body)
+		return nil, err
+	}
+	// the request may still be streaming while the reply is read
+	reply := &streamReply{body: body, rc: rc}
+	if reply.Reader, err = c.newHessian(rc).BinaryReader(); err != nil {
+		reply.Close()
+		return nil, err
+	}
+	return reply, nil
+}
+
+// streamReply is a binary reply read from the response of a request
+type streamReply struct {
+	io.Reader
+	body io.Reader
+	rc   io.ReadCloser
+}
+
+// Close close the response and stop streaming the request
+func (r *streamReply) Close() error {
+	closeBody(r.body)
+	return r.rc.Close()
+}
+
+// closeBody close the pipe of a streamed request body
+func closeBody(body io.Reader) {
+	if pr, ok := body.(io.Closer); ok {
+		pr.Close()
+	}
+}
+
+// BinaryReader return a reader of the next value, which must be binary or
+// null, reading its chunks as they are read. A reply head is skipped and a
+// fault is returned as error. A short read is returned as *DecodeError.
+func (h *Hessian) BinaryReader() (io.Reader, error) {
+	for {
+		t, err := h.peekByte()
+		if err != nil {
+			return nil, h.fail(0, err)
+		}
+		switch {
+		case t == 'r' && !h.Hessian2:
+			if _, err := h.next(3); err != nil {
+				return nil, h.fail(t, err) // reply and version
+			}
+			continue
+		case t == 'H' && !h.Hessian2:
+			h.discard(1)
+			if err := h.reply2(); err != nil {
+				return nil, h.fail(t, err)
+			}
+			continue
+		case t == 'f' && !h.Hessian2:
+			_, err := h.Parse()
+			return nil, err
+		case t == 'N':
+			h.discard(1)
+			return bytes.NewReader(nil), nil
+		case t == 'B', t == 'b' && !h.Hessian2, h.Hessian2 && (t == 'A' ||
+			t >= 0x20 && t <= 0x2f || t >= 0x34 && t <= 0x37):
+			return &binaryReader{h: h}, nil
+		}
+		return nil, &DecodeError{Offset: h.offset, Tag: t, Err: errors.New("want binary")}
+	}
+}
+
+// binaryReader read the chunks of a binary value
+type binaryReader struct {
+	h       *Hessian
+	tag     byte // tag of the current chunk
+	left    int  // bytes left in the current chunk
+	final   bool // the current chunk is the last one
+	started bool
+}
+
+func (r *binaryReader) Read(p []byte) (n int, err error) {
+	for r.left == 0 {
+		if r.final {
+			return 0, io.EOF
+		}
+		if err = r.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > r.left {
+		p = p[:r.left]
+	}
+	n, err = r.h.reader.Read(p)
+	r.h.offset += int64(n)
+	r.left -= n
+	if err != nil {
+		err = r.h.fail(r.tag, err)
+	}
+	return n, err
+}
+
+// nextChunk read the head of the next chunk
+func (r *binaryReader) nextChunk() (err error) {
+	if !r.started || r.h.Hessian2 {
+		r.tag, err = r.h.readByte()
+		r.started = true
+	} else {
+		r.tag, err = r.h.nextChunk(r.tag)
+	}
+	if err == nil {
+		r.left, r.final, err = r.h.binaryChunk(r.tag)
+	}
+	return r.h.fail(r.tag, err)
+}
@@ -0,0 +1,31 @@
+package gohessian
+
+// TypedMap is a map decoded with its java type name, see Hessian.TypedValues
+type TypedMap struct {
+	Type    string
+	Entries map[interface{}]interface{}
+}
+
+// MarshalHessian encode the map with its type name
+func (m TypedMap) MarshalHessian() ([]byte, error) {
+	return encodeOptions{}.encodeTypedMap(m.Type, m.entries())
+}
+
+// entries return the entries, an empty map if nil
+func (m TypedMap) entries() map[interface{}]interface{} {
+	if m.Entries == nil {
+		return map[interface{}]interface{}{}
+	}
+	return m.Entries
+}
+
+// TypedList is a list decoded with its java type name, see Hessian.TypedValues
+type TypedList struct {
+	Type  string
+	Items []interface{}
+}
+
+// MarshalHessian encode the list with its type name
+func (l TypedList) MarshalHessian() ([]byte, error) {
+	return encodeOptions{}.encodeTypedList(l.Type, l.Items)
+}
@@ -81,6 +81,15 @@ func UnpackInt16(b []byte) (pi int16, err error) {
 	return
 }
 
+//(0,2).unpack('n'), unsigned
+func UnpackUint16(b []byte) (pi uint16, err error) {
+	err = binary.Read(bytes.NewReader(b), binary.BigEndian, &pi)
+	if err != nil {
+		return
+	}
+	return
+}
+
 //(0,4).unpack('N')
 func UnpackInt32(b []byte) (pi int32, err error) {
 	err = binary.Read(bytes.NewReader(b), binary.BigEndian, &pi)